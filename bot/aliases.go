@@ -0,0 +1,83 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/example/filestoragebot/db"
+	"github.com/example/filestoragebot/models"
+)
+
+// maxAliases limits how many aliases a file may have.
+const maxAliases = 10
+
+// sendAliases lists the aliases of f with their downloads and buttons to add
+// and remove them.
+func (b *Bot) sendAliases(chatID int64, f *models.File) {
+	if err := b.db.LoadAliases(f); err != nil {
+		log.Println("db:", err)
+		return
+	}
+	counts := b.downloadsBySlug(f)
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Основная ссылка: %s — скачиваний: %d\n", b.linkURL(f.Slug), counts[f.Slug]))
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, a := range f.Aliases {
+		sb.WriteString(fmt.Sprintf("%s — скачиваний: %d\n", b.linkURL(a.Slug), counts[a.Slug]))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			"❌ "+a.Slug, fmt.Sprintf("unalias:%d:%s", a.ID, f.StorageName))))
+	}
+	if len(f.Aliases) == 0 {
+		sb.WriteString("Псевдонимов нет")
+	}
+	if len(f.Aliases) < maxAliases {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			"➕ Добавить", "addalias:"+f.StorageName)))
+	}
+	msg := tgbotapi.NewMessage(chatID, sb.String())
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	b.api.Send(msg)
+}
+
+func (b *Bot) finishAddAlias(userID int64, name string, m *tgbotapi.Message) {
+	b.deleteMessage(m.Chat.ID, m.MessageID)
+	f, err := b.db.GetFileByStorageName(name)
+	if err != nil || f.UserID != userID {
+		b.clearState(stateAlias, userID)
+		return
+	}
+	s, err := b.chooseSlug(m.Text)
+	if err != nil {
+		b.askLink(m.Chat.ID, userID, slugError(err))
+		return
+	}
+	if _, err := b.db.AddAlias(f.ID, s); err != nil {
+		if err == db.ErrSlugTaken || strings.Contains(err.Error(), "UNIQUE") {
+			b.askLink(m.Chat.ID, userID, "Ссылка уже занята, введите другую")
+			return
+		}
+		log.Println("db:", err)
+		b.clearState(stateAlias, userID)
+		return
+	}
+	b.clearState(stateAlias, userID)
+	b.sendAliases(m.Chat.ID, f)
+}
+
+// downloadsBySlug counts the downloads of f per link and alias. Downloads
+// logged before links were recorded belong to the main link.
+func (b *Bot) downloadsBySlug(f *models.File) map[string]int {
+	counts, err := b.logs.CountBySlug(f.ID)
+	if err != nil {
+		log.Println("logdb:", err)
+		return map[string]int{}
+	}
+	if n, ok := counts[""]; ok {
+		counts[f.Slug] += n
+		delete(counts, "")
+	}
+	return counts
+}
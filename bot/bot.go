@@ -1,61 +1,63 @@
 package bot
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"math/rand"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/example/filestoragebot/config"
 	"github.com/example/filestoragebot/db"
+	"github.com/example/filestoragebot/linksign"
 	"github.com/example/filestoragebot/logdb"
 	"github.com/example/filestoragebot/models"
+	"github.com/example/filestoragebot/money"
+	"github.com/example/filestoragebot/payments"
+	"github.com/example/filestoragebot/storage"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type Bot struct {
-	api  *tgbotapi.BotAPI
-	cfg  *config.Config
-	db   *db.DB
-	logs *logdb.DB
+	api       *tgbotapi.BotAPI
+	cfg       *config.Config
+	db        *db.DB
+	logs      *logdb.DB
+	store     storage.Backend
+	providers *payments.Registry
 
-	pendingUploads  map[int64]*uploadState
-	changeLink      map[int64]string
-	pendingInvoices map[string]*invoiceState
-	pendingTopup    map[int64]*topupState
-	adminAction     map[int64]string
-	filePage        map[int64]int
-	lastMessage     map[int64]int
+	lastMessage map[int64]int
 }
 
 type uploadState struct {
-	fileID   string
-	fileName string
-	fileSize int64
-	step     int
-	storage  string
-	local    string
-	link     string
-	notify   bool
-	cost     float64
-}
-
-type invoiceState struct {
-	userID   int64
-	amount   float64
-	provider string
+	FileID   string `json:"file_id"`
+	FileName string `json:"file_name"`
+	FileSize int64  `json:"file_size"`
+	Step     int    `json:"step"`
+	Storage  string `json:"storage"`
+	Local    string `json:"local"`
+	Link     string `json:"link"`
+	Notify   bool   `json:"notify"`
+	// Expiry is the link lifetime in days and MaxDownloads the download
+	// limit; zero means no limit.
+	Expiry       int          `json:"expiry"`
+	MaxDownloads int          `json:"max_downloads"`
+	Cost         money.Amount `json:"cost"`
+	// Reservation holds Cost on the balance until the upload is saved.
+	Reservation int64 `json:"reservation"`
+	Stored      bool  `json:"stored"`
 }
 
 type topupState struct {
-	step     int
-	amount   float64
-	provider string
+	Step     int          `json:"step"`
+	Amount   money.Amount `json:"amount"`
+	Provider string       `json:"provider"`
 }
 
 // Notify sends a message to user by internal DB id.
@@ -69,23 +71,38 @@ func (b *Bot) Notify(userID int64, message string) error {
 	return err
 }
 
-func New(cfg *config.Config, db *db.DB, logs *logdb.DB) (*Bot, error) {
-	api, err := tgbotapi.NewBotAPI(cfg.TelegramToken)
+// Download limits of the public Bot API and of a self-hosted
+// telegram-bot-api server.
+const (
+	publicFileLimit = 20 * 1024 * 1024
+	localFileLimit  = 2000 * 1024 * 1024
+)
+
+// maxTopup caps a single balance top-up.
+const maxTopup = 10000 * money.USDT
+
+func New(cfg *config.Config, db *db.DB, logs *logdb.DB, store storage.Backend, providers *payments.Registry) (*Bot, error) {
+	endpoint := tgbotapi.APIEndpoint
+	if cfg.TelegramAPIURL != "" {
+		endpoint = strings.TrimRight(cfg.TelegramAPIURL, "/") + "/bot%s/%s"
+	}
+	api, err := tgbotapi.NewBotAPIWithAPIEndpoint(cfg.TelegramToken, endpoint)
 	if err != nil {
 		return nil, err
 	}
 	b := &Bot{
-		api:             api,
-		cfg:             cfg,
-		db:              db,
-		logs:            logs,
-		pendingUploads:  make(map[int64]*uploadState),
-		changeLink:      make(map[int64]string),
-		pendingInvoices: make(map[string]*invoiceState),
-		pendingTopup:    make(map[int64]*topupState),
-		adminAction:     make(map[int64]string),
-		filePage:        make(map[int64]int),
-		lastMessage:     make(map[int64]int),
+		api:         api,
+		cfg:         cfg,
+		db:          db,
+		logs:        logs,
+		store:       store,
+		providers:   providers,
+		lastMessage: make(map[int64]int),
+	}
+	// Stars invoices are sent through this bot, so the provider can only be
+	// registered once the API client exists.
+	if cfg.StarsRate > 0 {
+		providers.Register(&payments.Stars{API: api, Rate: cfg.StarsRate, Min: cfg.StarsMinTopup})
 	}
 	b.checkTokens()
 	return b, nil
@@ -96,6 +113,9 @@ func (b *Bot) Start() {
 	u.Timeout = 60
 
 	updates := b.api.GetUpdatesChan(u)
+	go b.purgeState()
+	go b.pollInvoices()
+	go b.janitor()
 
 	for update := range updates {
 		if update.Message != nil {
@@ -104,6 +124,9 @@ func (b *Bot) Start() {
 		if update.CallbackQuery != nil {
 			b.handleCallback(update.CallbackQuery)
 		}
+		if update.PreCheckoutQuery != nil {
+			b.handlePreCheckout(update.PreCheckoutQuery)
+		}
 	}
 }
 
@@ -139,11 +162,22 @@ func (b *Bot) handleMessage(m *tgbotapi.Message) {
 		log.Println("db:", err)
 		return
 	}
-	if st, ok := b.pendingTopup[userID]; ok && !m.IsCommand() && m.Document == nil {
-		b.processTopup(userID, m, st)
+	if m.SuccessfulPayment != nil {
+		b.handleSuccessfulPayment(m.SuccessfulPayment)
 		return
 	}
-	if act, ok := b.adminAction[userID]; ok && !m.IsCommand() && m.Document == nil {
+	// ♻️ only takes the very next message; anything else cancels it so a
+	// later document is never swapped into a file by surprise
+	if m.Document == nil {
+		b.clearState(stateReplace, userID)
+	}
+	var topup topupState
+	if !m.IsCommand() && m.Document == nil && b.loadState(stateTopup, userID, &topup) {
+		b.processTopup(userID, m, &topup)
+		return
+	}
+	var act string
+	if !m.IsCommand() && m.Document == nil && b.loadState(stateAdmin, userID, &act) {
 		b.handleAdminInput(userID, act, m)
 		return
 	}
@@ -152,16 +186,42 @@ func (b *Bot) handleMessage(m *tgbotapi.Message) {
 		return
 	}
 
-	if st, ok := b.pendingUploads[userID]; ok && m.Document == nil {
-		b.handleUploadStep(userID, st, m)
+	var upload uploadState
+	if m.Document == nil && b.loadState(stateUpload, userID, &upload) {
+		b.handleUploadStep(userID, &upload, m)
 		return
 	}
 
-	if linkName, ok := b.changeLink[userID]; ok && m.Document == nil {
+	var linkName string
+	if m.Document == nil && b.loadState(stateLink, userID, &linkName) {
 		b.finishChangeLink(userID, linkName, m)
 		return
 	}
 
+	var aliasFile string
+	if m.Document == nil && b.loadState(stateAlias, userID, &aliasFile) {
+		b.finishAddAlias(userID, aliasFile, m)
+		return
+	}
+
+	var passwordFile string
+	if m.Document == nil && b.loadState(statePassword, userID, &passwordFile) {
+		b.finishSetPassword(userID, passwordFile, m)
+		return
+	}
+
+	var describeFile string
+	if m.Document == nil && b.loadState(stateDescription, userID, &describeFile) {
+		b.finishSetDescription(userID, describeFile, m)
+		return
+	}
+
+	var replaceFile string
+	if m.Document != nil && b.loadState(stateReplace, userID, &replaceFile) {
+		b.finishReplace(userID, replaceFile, m)
+		return
+	}
+
 	if m.Document != nil {
 		b.handleDocument(userID, m)
 		return
@@ -172,19 +232,19 @@ func (b *Bot) handleMessage(m *tgbotapi.Message) {
 		b.deleteLast(userID, m.Chat.ID)
 		b.deleteMessage(m.Chat.ID, m.MessageID)
 		msg := tgbotapi.NewMessage(m.Chat.ID,
-			fmt.Sprintf("\xF0\x9F\x93\x84 Отправьте файл. Стоимость загрузки от %.2f USDT", b.cfg.PriceUpload))
+			fmt.Sprintf("\xF0\x9F\x93\x84 Отправьте файл. Стоимость загрузки от %s USDT", b.cfg.PriceUpload))
 		b.sendTemp(m.Chat.ID, userID, msg)
 		return
 	case "\xF0\x9F\x93\x82 Мои файлы":
 		b.deleteLast(userID, m.Chat.ID)
 		b.deleteMessage(m.Chat.ID, m.MessageID)
-		b.filePage[userID] = 0
+		b.saveState(statePage, userID, 0)
 		b.sendFileList(userID, m.Chat.ID, 0)
 		return
 	case "\xF0\x9F\x92\xB0 Пополнить счёт":
 		b.deleteLast(userID, m.Chat.ID)
 		b.deleteMessage(m.Chat.ID, m.MessageID)
-		b.pendingTopup[userID] = &topupState{step: 1}
+		b.saveState(stateTopup, userID, topupState{Step: 1})
 		msg := tgbotapi.NewMessage(m.Chat.ID, "\xF0\x9F\x92\xB0 Введите сумму")
 		msg.ReplyMarkup = tgbotapi.ForceReply{ForceReply: true}
 		b.sendTemp(m.Chat.ID, userID, msg)
@@ -200,7 +260,7 @@ func (b *Bot) handleMessage(m *tgbotapi.Message) {
 		if m.From.ID == b.cfg.AdminID {
 			b.deleteLast(userID, m.Chat.ID)
 			b.deleteMessage(m.Chat.ID, m.MessageID)
-			b.adminAction[userID] = "userinfo"
+			b.saveState(stateAdmin, userID, "userinfo")
 			msg := tgbotapi.NewMessage(m.Chat.ID, "Введите telegram id")
 			msg.ReplyMarkup = tgbotapi.ForceReply{ForceReply: true}
 			b.sendTemp(m.Chat.ID, userID, msg)
@@ -210,7 +270,7 @@ func (b *Bot) handleMessage(m *tgbotapi.Message) {
 		if m.From.ID == b.cfg.AdminID {
 			b.deleteLast(userID, m.Chat.ID)
 			b.deleteMessage(m.Chat.ID, m.MessageID)
-			b.adminAction[userID] = "addbal"
+			b.saveState(stateAdmin, userID, "addbal")
 			msg := tgbotapi.NewMessage(m.Chat.ID, "Введите telegram id и сумму через пробел")
 			msg.ReplyMarkup = tgbotapi.ForceReply{ForceReply: true}
 			b.sendTemp(m.Chat.ID, userID, msg)
@@ -220,7 +280,7 @@ func (b *Bot) handleMessage(m *tgbotapi.Message) {
 		if m.From.ID == b.cfg.AdminID {
 			b.deleteLast(userID, m.Chat.ID)
 			b.deleteMessage(m.Chat.ID, m.MessageID)
-			b.adminAction[userID] = "setbal"
+			b.saveState(stateAdmin, userID, "setbal")
 			msg := tgbotapi.NewMessage(m.Chat.ID, "Введите telegram id и новый баланс")
 			msg.ReplyMarkup = tgbotapi.ForceReply{ForceReply: true}
 			b.sendTemp(m.Chat.ID, userID, msg)
@@ -248,7 +308,7 @@ func (b *Bot) handleMessage(m *tgbotapi.Message) {
 				if f.Notify {
 					notif = "вкл"
 				}
-				sb.WriteString(fmt.Sprintf("%s | %s | %s\n", f.CreatedAt, notif, f.Link))
+				sb.WriteString(fmt.Sprintf("%s | %s | %s\n", f.CreatedAt, notif, b.linkURL(f.Slug)))
 			}
 			msg := tgbotapi.NewMessage(m.Chat.ID, sb.String())
 			msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(
@@ -263,19 +323,21 @@ func (b *Bot) handleMessage(m *tgbotapi.Message) {
 		b.sendMainMenu(m.Chat.ID, userID, m.From.ID == b.cfg.AdminID)
 		return
 	case "⬅️":
-		if p, ok := b.filePage[userID]; ok {
+		var p int
+		if b.loadState(statePage, userID, &p) {
 			if p > 0 {
 				p--
 			}
-			b.filePage[userID] = p
+			b.saveState(statePage, userID, p)
 			b.deleteMessage(m.Chat.ID, m.MessageID)
 			b.sendFileList(userID, m.Chat.ID, p)
 		}
 		return
 	case "➡️":
-		if p, ok := b.filePage[userID]; ok {
+		var p int
+		if b.loadState(statePage, userID, &p) {
 			p++
-			b.filePage[userID] = p
+			b.saveState(statePage, userID, p)
 			b.deleteMessage(m.Chat.ID, m.MessageID)
 			b.sendFileList(userID, m.Chat.ID, p)
 		}
@@ -283,27 +345,56 @@ func (b *Bot) handleMessage(m *tgbotapi.Message) {
 	}
 
 	if f, err := b.db.GetFileByLocalName(userID, m.Text); err == nil {
-		notif := "🔔❌"
-		if f.Notify {
-			notif = "🔔✅"
-		}
-		kb := tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("🔗", "link:"+f.StorageName),
-				tgbotapi.NewInlineKeyboardButtonData(notif, "notify:"+f.StorageName),
-				tgbotapi.NewInlineKeyboardButtonData("📄", "log:"+f.StorageName),
-				tgbotapi.NewInlineKeyboardButtonData("❌", "delete:"+f.StorageName),
-			),
-		)
 		b.deleteLast(userID, m.Chat.ID)
 		b.deleteMessage(m.Chat.ID, m.MessageID)
-		msg := tgbotapi.NewMessage(m.Chat.ID, f.LocalName+" -> "+f.Link)
-		msg.ReplyMarkup = kb
-		b.sendTemp(m.Chat.ID, userID, msg)
+		b.sendTemp(m.Chat.ID, userID, b.fileMenu(m.Chat.ID, f))
 		return
 	}
 }
 
+// fileMenu builds the message with the management keyboard of a file.
+func (b *Bot) fileMenu(chatID int64, f *models.File) tgbotapi.MessageConfig {
+	notif := "🔔❌"
+	if f.Notify {
+		notif = "🔔✅"
+	}
+	lock := "🔓"
+	if f.PasswordHash != "" {
+		lock = "🔒"
+	}
+	page := "📰 Страница: ❌"
+	if f.Landing {
+		page = "📰 Страница: ✅"
+	}
+	kb := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔗", "link:"+f.StorageName),
+			tgbotapi.NewInlineKeyboardButtonData(notif, "notify:"+f.StorageName),
+			tgbotapi.NewInlineKeyboardButtonData("📄", "log:"+f.StorageName),
+			tgbotapi.NewInlineKeyboardButtonData("❌", "delete:"+f.StorageName),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⏳", "limits:"+f.StorageName),
+			tgbotapi.NewInlineKeyboardButtonData(lock, "password:"+f.StorageName),
+			tgbotapi.NewInlineKeyboardButtonData("🔥", "onetime:"+f.StorageName),
+			tgbotapi.NewInlineKeyboardButtonData("✍️", "sign:"+f.StorageName),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(page, "landing:"+f.StorageName),
+			tgbotapi.NewInlineKeyboardButtonData("📝 Описание", "describe:"+f.StorageName),
+			tgbotapi.NewInlineKeyboardButtonData("↪️ Старые ссылки", "oldlinks:"+f.StorageName),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🏷 Псевдонимы", "aliases:"+f.StorageName),
+			tgbotapi.NewInlineKeyboardButtonData("♻️ Заменить", "replace:"+f.StorageName),
+			tgbotapi.NewInlineKeyboardButtonData("🗂 Версии", "versions:"+f.StorageName),
+		),
+	)
+	msg := tgbotapi.NewMessage(chatID, f.LocalName+" -> "+b.linkURL(f.Slug)+"\n"+describeLimits(f))
+	msg.ReplyMarkup = kb
+	return msg
+}
+
 func (b *Bot) handleCommand(userID int64, m *tgbotapi.Message) {
 	switch m.Command() {
 	case "start":
@@ -312,13 +403,26 @@ func (b *Bot) handleCommand(userID int64, m *tgbotapi.Message) {
 	case "help":
 		b.sendMainMenu(m.Chat.ID, userID, m.From.ID == b.cfg.AdminID)
 		b.deleteMessage(m.Chat.ID, m.MessageID)
+	case "cancel":
+		b.deleteMessage(m.Chat.ID, m.MessageID)
+		b.cancelUpload(userID, m.Chat.ID)
 	}
 }
 
 func (b *Bot) handleDocument(userID int64, m *tgbotapi.Message) {
-	if _, ok := b.pendingUploads[userID]; ok {
+	var pending uploadState
+	if b.loadState(stateUpload, userID, &pending) {
 		b.deleteMessage(m.Chat.ID, m.MessageID)
-		msg := tgbotapi.NewMessage(m.Chat.ID, "Завершите предыдущую загрузку")
+		msg := tgbotapi.NewMessage(m.Chat.ID, "Завершите предыдущую загрузку или отмените её")
+		msg.ReplyMarkup = cancelUploadKeyboard()
+		b.sendTemp(m.Chat.ID, userID, msg)
+		return
+	}
+
+	if limit := b.fileLimit(); int64(m.Document.FileSize) > limit {
+		b.deleteMessage(m.Chat.ID, m.MessageID)
+		msg := tgbotapi.NewMessage(m.Chat.ID,
+			fmt.Sprintf("\xE2\x9D\x8C Файл слишком большой, максимум %d МБ", limit/(1024*1024)))
 		b.sendTemp(m.Chat.ID, userID, msg)
 		return
 	}
@@ -326,50 +430,60 @@ func (b *Bot) handleDocument(userID int64, m *tgbotapi.Message) {
 	cost := b.cfg.PriceUpload
 	if m.Document.FileSize > int(b.cfg.MaxFileSize) {
 		extra := (int64(m.Document.FileSize) - b.cfg.MaxFileSize + 50*1024*1024 - 1) / (50 * 1024 * 1024)
-		cost += float64(extra)
+		cost += money.Amount(extra) * money.USDT
 	}
 
-	bal, err := b.db.GetBalance(userID)
-	if err != nil {
-		log.Println(err)
+	reservation, err := b.db.Reserve(userID, cost)
+	if err == db.ErrInsufficientFunds {
+		b.api.Send(tgbotapi.NewMessage(m.Chat.ID, "\xE2\x9D\x8C Недостаточно средств"))
 		return
 	}
-	if bal < cost {
-		b.api.Send(tgbotapi.NewMessage(m.Chat.ID, "\xE2\x9D\x8C Недостаточно средств"))
+	if err != nil {
+		log.Println(err)
 		return
 	}
 
 	rand.Seed(time.Now().UnixNano())
 	storageName := fmt.Sprintf("%d_%d", userID, rand.Int63())
 
-	b.pendingUploads[userID] = &uploadState{
-		fileID:   m.Document.FileID,
-		fileName: m.Document.FileName,
-		fileSize: int64(m.Document.FileSize),
-		step:     1,
-		storage:  storageName,
-		cost:     cost,
-	}
+	b.saveState(stateUpload, userID, uploadState{
+		FileID:      m.Document.FileID,
+		FileName:    m.Document.FileName,
+		FileSize:    int64(m.Document.FileSize),
+		Step:        1,
+		Storage:     storageName,
+		Cost:        cost,
+		Reservation: reservation,
+	})
 
 	b.deleteMessage(m.Chat.ID, m.MessageID)
-	msg := tgbotapi.NewMessage(m.Chat.ID, "Введите локальное название файла")
+	msg := tgbotapi.NewMessage(m.Chat.ID, "Введите локальное название файла\n/cancel — отменить загрузку")
 	msg.ReplyMarkup = tgbotapi.ForceReply{ForceReply: true}
 	b.sendTemp(m.Chat.ID, userID, msg)
 }
 
 func (b *Bot) handleUploadStep(userID int64, st *uploadState, m *tgbotapi.Message) {
-	switch st.step {
+	switch st.Step {
 	case 1:
-		st.local = m.Text
-		st.step = 2
+		st.Local = m.Text
+		st.Step = 2
+		b.saveState(stateUpload, userID, st)
 		b.deleteMessage(m.Chat.ID, m.MessageID)
-		msg := tgbotapi.NewMessage(m.Chat.ID, "Введите часть ссылки")
-		msg.ReplyMarkup = tgbotapi.ForceReply{ForceReply: true}
-		b.sendTemp(m.Chat.ID, userID, msg)
+		b.askLink(m.Chat.ID, userID, "Введите часть ссылки или получите случайную")
 	case 2:
-		st.link = strings.TrimSpace(m.Text)
-		st.step = 3
 		b.deleteMessage(m.Chat.ID, m.MessageID)
+		s, err := b.chooseSlug(m.Text)
+		if err != nil {
+			b.askLink(m.Chat.ID, userID, slugError(err))
+			return
+		}
+		if taken, err := b.db.SlugTaken(s); err != nil || taken {
+			b.askLink(m.Chat.ID, userID, "Ссылка уже занята, введите другую")
+			return
+		}
+		st.Link = s
+		st.Step = 3
+		b.saveState(stateUpload, userID, st)
 		kb := tgbotapi.NewReplyKeyboard(
 			tgbotapi.NewKeyboardButtonRow(
 				tgbotapi.NewKeyboardButton("Да"),
@@ -380,286 +494,198 @@ func (b *Bot) handleUploadStep(userID int64, st *uploadState, m *tgbotapi.Messag
 		b.sendTemp(m.Chat.ID, userID, msg)
 	case 3:
 		txt := strings.ToLower(m.Text)
-		st.notify = txt == "да"
+		st.Notify = txt == "да"
+		st.Step = 4
+		b.saveState(stateUpload, userID, st)
+		b.deleteMessage(m.Chat.ID, m.MessageID)
+		var row []tgbotapi.KeyboardButton
+		for _, c := range expiryChoices {
+			row = append(row, tgbotapi.NewKeyboardButton(c.Label))
+		}
+		msg := tgbotapi.NewMessage(m.Chat.ID, "Срок действия ссылки (выберите или введите число дней)")
+		msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(row)
+		b.sendTemp(m.Chat.ID, userID, msg)
+	case 4:
 		b.deleteMessage(m.Chat.ID, m.MessageID)
+		days, ok := parseExpiry(m.Text)
+		if !ok {
+			msg := tgbotapi.NewMessage(m.Chat.ID, "Неверный срок, введите число дней")
+			b.sendTemp(m.Chat.ID, userID, msg)
+			return
+		}
+		st.Expiry = days
+		st.Step = 5
+		b.saveState(stateUpload, userID, st)
+		var row []tgbotapi.KeyboardButton
+		for _, c := range limitChoices {
+			row = append(row, tgbotapi.NewKeyboardButton(c.Label))
+		}
+		msg := tgbotapi.NewMessage(m.Chat.ID, "Лимит скачиваний (выберите или введите число)")
+		msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(row)
+		b.sendTemp(m.Chat.ID, userID, msg)
+	case 5:
+		b.deleteMessage(m.Chat.ID, m.MessageID)
+		limit, ok := parseLimit(m.Text)
+		if !ok {
+			msg := tgbotapi.NewMessage(m.Chat.ID, "Неверный лимит, введите число")
+			b.sendTemp(m.Chat.ID, userID, msg)
+			return
+		}
+		st.MaxDownloads = limit
 		if err := b.finalizeUpload(userID, st, m.Chat.ID); err != nil {
 			if strings.Contains(err.Error(), "UNIQUE") {
-				st.step = 2
-				msg := tgbotapi.NewMessage(m.Chat.ID, "Ссылка уже занята, введите другую")
-				msg.ReplyMarkup = tgbotapi.ForceReply{ForceReply: true}
-				b.sendTemp(m.Chat.ID, userID, msg)
+				st.Step = 2
+				b.saveState(stateUpload, userID, st)
+				b.askLink(m.Chat.ID, userID, "Ссылка уже занята, введите другую")
 				return
 			}
 			log.Println(err)
-			delete(b.pendingUploads, userID)
-			msg := tgbotapi.NewMessage(m.Chat.ID, "Ошибка сохранения")
+			if st.Stored {
+				b.store.Delete(st.Storage)
+			}
+			if err := b.db.ReleaseReservation(st.Reservation); err != nil {
+				log.Println(err)
+			}
+			b.clearState(stateUpload, userID)
+			text := "Ошибка сохранения"
+			if err == db.ErrInsufficientFunds {
+				text = "\xE2\x9D\x8C Недостаточно средств"
+			}
+			msg := tgbotapi.NewMessage(m.Chat.ID, text)
 			b.sendTemp(m.Chat.ID, userID, msg)
 			return
 		}
-		delete(b.pendingUploads, userID)
+		b.clearState(stateUpload, userID)
 		b.sendMainMenu(m.Chat.ID, userID, false)
 	}
 }
 
-func (b *Bot) finalizeUpload(userID int64, st *uploadState, chatID int64) error {
-	url, err := b.api.GetFileDirectURL(st.fileID)
-	if err != nil {
-		log.Println(err)
-		return err
-	}
-	resp, err := http.Get(url)
-	if err != nil {
-		log.Println(err)
-		return err
-	}
-	defer resp.Body.Close()
+// cancelUploadKeyboard offers to abandon the upload in progress.
+func cancelUploadKeyboard() tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("✖️ Отменить загрузку", "cancelupload")))
+}
 
-	os.MkdirAll(b.cfg.FileStoragePath, 0755)
-	path := filepath.Join(b.cfg.FileStoragePath, st.storage)
-	out, err := os.Create(path)
-	if err != nil {
-		log.Println(err)
-		return err
-	}
-	defer out.Close()
-	if _, err := io.Copy(out, resp.Body); err != nil {
-		log.Println(err)
-		return err
+// cancelUpload abandons the upload wizard and gives the reserved fee back.
+func (b *Bot) cancelUpload(userID, chatID int64) {
+	var st uploadState
+	if !b.loadState(stateUpload, userID, &st) {
+		b.sendTemp(chatID, userID, tgbotapi.NewMessage(chatID, "Нет загрузки для отмены"))
+		return
 	}
-
-	link := strings.TrimRight(b.cfg.Domain, "/") + "/" + st.link
-	f := &models.File{
-		UserID:      userID,
-		LocalName:   st.local,
-		StorageName: st.storage,
-		Link:        link,
-		Notify:      st.notify,
-		Size:        st.fileSize,
-	}
-	if err := b.db.AddFile(f); err != nil {
-		log.Println(err)
-		return err
+	b.clearState(stateUpload, userID)
+	if st.Stored {
+		if err := b.store.Delete(st.Storage); err != nil {
+			log.Println("storage:", err)
+		}
 	}
-
-	if err := b.db.AdjustBalance(userID, -st.cost); err != nil {
+	if err := b.db.ReleaseReservation(st.Reservation); err != nil {
 		log.Println(err)
 	}
-
-	b.deleteLast(userID, chatID)
-	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Файл сохранён: %s", link))
-	b.api.Send(msg)
-	return nil
-}
-
-func (b *Bot) createInvoice(amount float64) (string, string, string, error) {
-	if b.cfg.CryptoBotToken != "" {
-		url, id, err := b.createCryptoInvoice(amount)
-		return url, id, "crypto", err
-	}
-	if b.cfg.XRocketToken != "" {
-		url, id, err := b.createXRocketInvoice(amount)
-		return url, id, "xrocket", err
-	}
-	return "", "", "", fmt.Errorf("нет провайдера оплаты")
+	b.sendMainMenu(chatID, userID, false)
 }
 
-func (b *Bot) createInvoiceProvider(amount float64, provider string) (string, string, string, error) {
-	switch provider {
-	case "crypto":
-		if b.cfg.CryptoBotToken == "" {
-			return "", "", "", fmt.Errorf("provider disabled")
-		}
-		url, id, err := b.createCryptoInvoice(amount)
-		return url, id, "crypto", err
-	case "xrocket":
-		if b.cfg.XRocketToken == "" {
-			return "", "", "", fmt.Errorf("provider disabled")
-		}
-		url, id, err := b.createXRocketInvoice(amount)
-		return url, id, "xrocket", err
-	default:
-		return b.createInvoice(amount)
+// fileLimit returns the largest document the bot is able to download.
+func (b *Bot) fileLimit() int64 {
+	if b.cfg.TelegramLocal {
+		return localFileLimit
 	}
+	return publicFileLimit
 }
 
-var cryptoAPIBase = "https://pay.crypt.bot/api/"
-var xrocketAPIBase = "https://pay.xrocket.tg/"
-
-func (b *Bot) createCryptoInvoice(amount float64) (string, string, error) {
-	body := fmt.Sprintf(`{"asset":"USDT","amount":"%.2f","description":"Пополнение счёта на %.2f$"}`,
-		amount, amount)
-	req, err := http.NewRequest("POST", cryptoAPIBase+"createInvoice", strings.NewReader(body))
-	if err != nil {
-		return "", "", err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Crypto-Pay-API-Token", b.cfg.CryptoBotToken)
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", "", fmt.Errorf("CryptoBot request: %w", err)
-	}
-	defer resp.Body.Close()
-	data, err := io.ReadAll(resp.Body)
+// storeTelegramFile saves a Telegram document into the storage backend. A
+// telegram-bot-api server running with --local returns absolute paths on its
+// disk, so the file is moved (or copied) from there instead of fetched.
+func (b *Bot) storeTelegramFile(fileID, name string) error {
+	file, err := b.api.GetFile(tgbotapi.FileConfig{FileID: fileID})
 	if err != nil {
-		return "", "", fmt.Errorf("CryptoBot read: %w", err)
-	}
-	if resp.StatusCode != http.StatusOK {
-		return "", "", fmt.Errorf("CryptoBot HTTP %d: %s", resp.StatusCode, string(data))
-	}
-	type res struct {
-		Ok     bool `json:"ok"`
-		Result struct {
-			InvoiceID json.Number `json:"invoice_id"`
-			PayURL    string      `json:"pay_url"`
-		} `json:"result"`
-	}
-	var r res
-	if err := json.Unmarshal(data, &r); err != nil {
-		return "", "", fmt.Errorf("CryptoBot decode: %w", err)
+		return err
 	}
-	if !r.Ok {
-		return "", "", fmt.Errorf("CryptoBot API error: %s", string(data))
+	if b.cfg.TelegramLocal && filepath.IsAbs(file.FilePath) {
+		if l, ok := b.store.(*storage.Local); ok {
+			return l.Move(name, file.FilePath)
+		}
+		in, err := os.Open(file.FilePath)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		size := int64(-1)
+		if st, err := in.Stat(); err == nil {
+			size = st.Size()
+		}
+		if err := b.store.Put(name, in, size); err != nil {
+			return err
+		}
+		return os.Remove(file.FilePath)
 	}
-	return r.Result.PayURL, r.Result.InvoiceID.String(), nil
-}
 
-func (b *Bot) createXRocketInvoice(amount float64) (string, string, error) {
-	body := fmt.Sprintf(`{"amount":%.2f,"numPayments":1,"currency":"USDT","description":"Пополнение счёта на %.2f$"}`,
-		amount, amount)
-	req, err := http.NewRequest("POST", xrocketAPIBase+"tg-invoices", strings.NewReader(body))
-	if err != nil {
-		return "", "", err
+	fileEndpoint := tgbotapi.FileEndpoint
+	if b.cfg.TelegramAPIURL != "" {
+		fileEndpoint = strings.TrimRight(b.cfg.TelegramAPIURL, "/") + "/file/bot%s/%s"
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Rocket-Pay-Key", b.cfg.XRocketToken)
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := http.Get(fmt.Sprintf(fileEndpoint, b.api.Token, file.FilePath))
 	if err != nil {
-		return "", "", fmt.Errorf("XRocket request: %w", err)
+		return err
 	}
 	defer resp.Body.Close()
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", "", fmt.Errorf("XRocket read: %w", err)
-	}
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return "", "", fmt.Errorf("XRocket HTTP %d: %s", resp.StatusCode, string(data))
-	}
-	type res struct {
-		Ok      bool `json:"ok"`
-		Success bool `json:"success"`
-		Result  struct {
-			ID  string `json:"id"`
-			URL string `json:"url"`
-		} `json:"result"`
-		Data struct {
-			ID   string `json:"id"`
-			Link string `json:"link"`
-		} `json:"data"`
-	}
-	var r res
-	if err := json.Unmarshal(data, &r); err != nil {
-		return "", "", fmt.Errorf("XRocket decode: %w", err)
-	}
-	switch {
-	case r.Ok:
-		return r.Result.URL, r.Result.ID, nil
-	case r.Success:
-		return r.Data.Link, r.Data.ID, nil
-	default:
-		return "", "", fmt.Errorf("XRocket API error: %s", string(data))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("telegram file HTTP %d", resp.StatusCode)
 	}
+	return b.store.Put(name, resp.Body, resp.ContentLength)
 }
 
-func (b *Bot) checkInvoice(id, provider string) (bool, error) {
-	if provider == "crypto" && b.cfg.CryptoBotToken != "" {
-		return b.checkCryptoInvoice(id)
+func (b *Bot) finalizeUpload(userID int64, st *uploadState, chatID int64) error {
+	// the blob is kept between retries when the chosen link is taken
+	if !st.Stored {
+		if err := b.storeTelegramFile(st.FileID, st.Storage); err != nil {
+			log.Println(err)
+			return err
+		}
+		st.Stored = true
 	}
-	if provider == "xrocket" && b.cfg.XRocketToken != "" {
-		return b.checkXRocketInvoice(id)
+
+	f := &models.File{
+		UserID:       userID,
+		LocalName:    st.Local,
+		FileName:     st.FileName,
+		StorageName:  st.Storage,
+		Slug:         st.Link,
+		Notify:       st.Notify,
+		Size:         st.FileSize,
+		ExpiresAt:    expiresAt(st.Expiry),
+		MaxDownloads: st.MaxDownloads,
+	}
+	if err := b.db.AddFileReserved(f, st.Reservation, st.Cost); err != nil {
+		log.Println(err)
+		return err
 	}
-	return false, fmt.Errorf("нет провайдера")
+
+	b.deleteLast(userID, chatID)
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Файл сохранён: %s", b.linkURL(f.Slug)))
+	b.api.Send(msg)
+	return nil
 }
 
-func (b *Bot) checkCryptoInvoice(id string) (bool, error) {
-	urlStr := cryptoAPIBase + "getInvoices"
-	body := fmt.Sprintf(`{"invoice_ids":[%s]}`, id)
-	req, err := http.NewRequest("POST", urlStr, strings.NewReader(body))
+// createInvoice issues an invoice with the first enabled provider.
+func (b *Bot) createInvoice(amount money.Amount) (string, string, string, error) {
+	p, err := b.providers.Default()
 	if err != nil {
-		return false, err
+		return "", "", "", err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Crypto-Pay-API-Token", b.cfg.CryptoBotToken)
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return false, fmt.Errorf("CryptoBot request: %w", err)
-	}
-	defer resp.Body.Close()
-	data, err := io.ReadAll(resp.Body)
+	inv, err := p.CreateInvoice(amount)
 	if err != nil {
-		return false, fmt.Errorf("CryptoBot read: %w", err)
+		return "", "", "", err
 	}
-	if resp.StatusCode != http.StatusOK {
-		return false, fmt.Errorf("CryptoBot HTTP %d: %s", resp.StatusCode, string(data))
-	}
-	type res struct {
-		Ok     bool `json:"ok"`
-		Result struct {
-			Items []struct {
-				Status string `json:"status"`
-			} `json:"items"`
-		} `json:"result"`
-	}
-	var r res
-	if err := json.Unmarshal(data, &r); err != nil {
-		return false, fmt.Errorf("CryptoBot decode: %w", err)
-	}
-	if !r.Ok || len(r.Result.Items) == 0 {
-		return false, fmt.Errorf("CryptoBot API error: %s", string(data))
-	}
-	return r.Result.Items[0].Status == "paid", nil
+	return inv.URL, inv.ID, p.Name(), nil
 }
 
-func (b *Bot) checkXRocketInvoice(id string) (bool, error) {
-	urlStr := xrocketAPIBase + "tg-invoices/" + id
-	req, err := http.NewRequest("GET", urlStr, nil)
-	if err != nil {
-		return false, err
-	}
-	req.Header.Set("Rocket-Pay-Key", b.cfg.XRocketToken)
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return false, fmt.Errorf("XRocket request: %w", err)
-	}
-	defer resp.Body.Close()
-	data, err := io.ReadAll(resp.Body)
+func (b *Bot) checkInvoice(id, provider string) (bool, error) {
+	p, err := b.providers.Get(provider)
 	if err != nil {
-		return false, fmt.Errorf("XRocket read: %w", err)
-	}
-	if resp.StatusCode != http.StatusOK {
-		return false, fmt.Errorf("XRocket HTTP %d: %s", resp.StatusCode, string(data))
-	}
-	type res struct {
-		Ok      bool `json:"ok"`
-		Success bool `json:"success"`
-		Result  struct {
-			Status string `json:"status"`
-		} `json:"result"`
-		Data struct {
-			Status string `json:"status"`
-		} `json:"data"`
-	}
-	var r res
-	if err := json.Unmarshal(data, &r); err != nil {
-		return false, fmt.Errorf("XRocket decode: %w", err)
-	}
-	switch {
-	case r.Ok:
-		return r.Result.Status == "paid", nil
-	case r.Success:
-		return r.Data.Status == "paid", nil
-	default:
-		return false, fmt.Errorf("XRocket API error: %s", string(data))
+		return false, fmt.Errorf("нет провайдера")
 	}
+	return p.CheckInvoice(id)
 }
 
 func (b *Bot) handleCallback(q *tgbotapi.CallbackQuery) {
@@ -674,48 +700,49 @@ func (b *Bot) handleCallback(q *tgbotapi.CallbackQuery) {
 		log.Println(err)
 		return
 	}
+	if action != "replace" {
+		b.clearState(stateReplace, userID)
+	}
 	switch action {
 	case "checkpay":
-		state, ok := b.pendingInvoices[arg]
-		if !ok || state.userID != userID {
+		provider, invoiceID, _ := strings.Cut(arg, ":")
+		p, err := b.db.GetPaymentByInvoice(provider, invoiceID)
+		if err != nil || p.UserID != userID {
 			b.api.Send(tgbotapi.NewCallback(q.ID, "Не найдено"))
 			return
 		}
-		paid, err := b.checkInvoice(arg, state.provider)
+		if p.Status != models.PaymentPending {
+			b.api.Send(tgbotapi.NewCallback(q.ID, "Счёт уже закрыт"))
+			return
+		}
+		paid, err := b.checkInvoice(p.InvoiceID, p.Provider)
 		if err != nil {
 			log.Println("check invoice:", err)
 			b.api.Send(tgbotapi.NewCallback(q.ID, "Ошибка"))
 			return
 		}
-		if paid {
-			b.db.AdjustBalance(userID, state.amount)
-			b.db.AddPayment(userID, state.amount)
-			delete(b.pendingInvoices, arg)
-			b.api.Send(tgbotapi.NewCallback(q.ID, "Оплачено"))
-			b.sendMainMenu(q.Message.Chat.ID, userID, q.From.ID == b.cfg.AdminID)
-		} else {
+		if !paid {
 			b.api.Send(tgbotapi.NewCallback(q.ID, "Не оплачено"))
+			return
 		}
+		if _, credited, err := b.db.CreditInvoice(p.Provider, p.InvoiceID); err != nil {
+			log.Println("credit invoice:", err)
+			b.api.Send(tgbotapi.NewCallback(q.ID, "Ошибка"))
+			return
+		} else if !credited {
+			b.api.Send(tgbotapi.NewCallback(q.ID, "Счёт уже закрыт"))
+			return
+		}
+		b.api.Send(tgbotapi.NewCallback(q.ID, "Оплачено"))
+		b.sendMainMenu(q.Message.Chat.ID, userID, q.From.ID == b.cfg.AdminID)
+	case "cancelupload":
+		b.cancelUpload(userID, q.Message.Chat.ID)
 	case "manage":
 		f, err := b.db.GetFileByStorageName(arg)
 		if err != nil || f.UserID != userID {
 			return
 		}
-		notif := "🔔❌"
-		if f.Notify {
-			notif = "🔔✅"
-		}
-		kb := tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("🔗", "link:"+arg),
-				tgbotapi.NewInlineKeyboardButtonData(notif, "notify:"+arg),
-				tgbotapi.NewInlineKeyboardButtonData("📄", "log:"+arg),
-				tgbotapi.NewInlineKeyboardButtonData("❌", "delete:"+arg),
-			),
-		)
-		msg := tgbotapi.NewMessage(q.Message.Chat.ID, f.LocalName+" -> "+f.Link)
-		msg.ReplyMarkup = kb
-		b.api.Send(msg)
+		b.api.Send(b.fileMenu(q.Message.Chat.ID, f))
 	case "log":
 		f, err := b.db.GetFileByStorageName(arg)
 		if err != nil || f.UserID != userID {
@@ -725,7 +752,7 @@ func (b *Bot) handleCallback(q *tgbotapi.CallbackQuery) {
 		if err != nil {
 			return
 		}
-		html := buildLogHTML(f, entries)
+		html := buildLogHTML(f, b.linkURL(f.Slug), entries, b.downloadsBySlug(f))
 		tmp := fmt.Sprintf("log_%d.html", f.ID)
 		os.WriteFile(tmp, []byte(html), 0644)
 		doc := tgbotapi.NewDocument(q.Message.Chat.ID, tgbotapi.FilePath(tmp))
@@ -748,35 +775,335 @@ func (b *Bot) handleCallback(q *tgbotapi.CallbackQuery) {
 	case "delete":
 		f, err := b.db.GetFileByStorageName(arg)
 		if err == nil && f.UserID == userID {
-			os.Remove(filepath.Join(b.cfg.FileStoragePath, f.StorageName))
-			b.db.DeleteFile(f.ID)
-			b.logs.Drop(f.ID)
-			b.db.AdjustBalance(userID, b.cfg.PriceRefund)
+			if b.removeFile(f) {
+				b.db.AdjustBalance(userID, b.cfg.PriceRefund)
+			}
 			b.api.Send(tgbotapi.NewCallback(q.ID, "Удалено"))
 		}
-	case "link":
-		b.changeLink[userID] = arg
-		msg := tgbotapi.NewMessage(q.Message.Chat.ID, "Введите новую ссылку")
+	case "limits":
+		f, err := b.db.GetFileByStorageName(arg)
+		if err != nil || f.UserID != userID {
+			return
+		}
+		var expiry, limit []tgbotapi.InlineKeyboardButton
+		for _, c := range expiryChoices {
+			expiry = append(expiry, tgbotapi.NewInlineKeyboardButtonData(c.Label, fmt.Sprintf("ttl:%d:%s", c.Days, arg)))
+		}
+		for _, c := range limitChoices {
+			limit = append(limit, tgbotapi.NewInlineKeyboardButtonData(c.Label, fmt.Sprintf("max:%d:%s", c.Max, arg)))
+		}
+		msg := tgbotapi.NewMessage(q.Message.Chat.ID, describeLimits(f)+"\nСрок считается от текущего момента.")
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(expiry, limit)
+		b.api.Send(msg)
+	case "ttl", "max":
+		val, name, _ := strings.Cut(arg, ":")
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			return
+		}
+		f, err := b.db.GetFileByStorageName(name)
+		if err != nil || f.UserID != userID {
+			return
+		}
+		if action == "ttl" {
+			f.ExpiresAt = expiresAt(n)
+		} else {
+			f.MaxDownloads = n
+		}
+		if err := b.db.SetFileLimits(f.ID, f.ExpiresAt, f.MaxDownloads); err != nil {
+			log.Println("db:", err)
+			b.api.Send(tgbotapi.NewCallback(q.ID, "Ошибка"))
+			return
+		}
+		b.api.Send(tgbotapi.NewCallback(q.ID, "Готово"))
+	case "sign":
+		f, err := b.db.GetFileByStorageName(arg)
+		if err != nil || f.UserID != userID {
+			return
+		}
+		var row []tgbotapi.InlineKeyboardButton
+		for _, c := range signChoices {
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(c.Label, fmt.Sprintf("signurl:%d:%s", c.Hours, arg)))
+		}
+		direct := "Прямая ссылка: ✅"
+		if f.SignedOnly {
+			direct = "Прямая ссылка: ❌"
+		}
+		msg := tgbotapi.NewMessage(q.Message.Chat.ID, "Срок действия подписанной ссылки")
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(row,
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(direct, "signedonly:"+arg)))
+		b.api.Send(msg)
+	case "signurl":
+		val, name, _ := strings.Cut(arg, ":")
+		hours, err := strconv.Atoi(val)
+		if err != nil || hours <= 0 {
+			return
+		}
+		f, err := b.db.GetFileByStorageName(name)
+		if err != nil || f.UserID != userID {
+			return
+		}
+		exp := time.Now().Add(time.Duration(hours) * time.Hour)
+		signed, err := linksign.Sign([]byte(b.cfg.ServerSecret), b.linkURL(f.Slug), exp)
+		if err != nil {
+			log.Println("sign:", err)
+			b.api.Send(tgbotapi.NewCallback(q.ID, "Ошибка"))
+			return
+		}
+		b.api.Send(tgbotapi.NewMessage(q.Message.Chat.ID,
+			fmt.Sprintf("Ссылка действует до %s UTC:\n%s", exp.UTC().Format("02.01.2006 15:04"), signed)))
+	case "signedonly":
+		f, err := b.db.GetFileByStorageName(arg)
+		if err != nil || f.UserID != userID {
+			return
+		}
+		if err := b.db.SetSignedOnly(f.ID, !f.SignedOnly); err != nil {
+			log.Println("db:", err)
+			b.api.Send(tgbotapi.NewCallback(q.ID, "Ошибка"))
+			return
+		}
+		text := "Прямая ссылка отключена"
+		if f.SignedOnly {
+			text = "Прямая ссылка включена"
+		}
+		b.api.Send(tgbotapi.NewCallback(q.ID, text))
+	case "onetime":
+		f, err := b.db.GetFileByStorageName(arg)
+		if err != nil || f.UserID != userID {
+			return
+		}
+		on := !f.OneTime || f.Consumed
+		if on && f.Consumed {
+			if _, err := b.store.Stat(f.Blob); err != nil {
+				b.api.Send(tgbotapi.NewCallback(q.ID, "Файл уже удалён"))
+				return
+			}
+		}
+		if err := b.db.SetOneTime(f.ID, on); err != nil {
+			log.Println("db:", err)
+			b.api.Send(tgbotapi.NewCallback(q.ID, "Ошибка"))
+			return
+		}
+		text := "Одноразовая ссылка выключена"
+		if on {
+			text = "Одноразовая ссылка включена"
+		}
+		b.api.Send(tgbotapi.NewCallback(q.ID, text))
+	case "landing":
+		f, err := b.db.GetFileByStorageName(arg)
+		if err != nil || f.UserID != userID {
+			return
+		}
+		if err := b.db.SetLanding(f.ID, !f.Landing); err != nil {
+			log.Println("db:", err)
+			b.api.Send(tgbotapi.NewCallback(q.ID, "Ошибка"))
+			return
+		}
+		text := "Страница файла включена"
+		if f.Landing {
+			text = "Страница файла выключена"
+		}
+		b.api.Send(tgbotapi.NewCallback(q.ID, text))
+	case "describe":
+		f, err := b.db.GetFileByStorageName(arg)
+		if err != nil || f.UserID != userID {
+			return
+		}
+		b.saveState(stateDescription, userID, arg)
+		msg := tgbotapi.NewMessage(q.Message.Chat.ID, "Введите описание для страницы файла или «-», чтобы удалить его")
+		msg.ReplyMarkup = tgbotapi.ForceReply{ForceReply: true}
+		b.api.Send(msg)
+	case "password":
+		f, err := b.db.GetFileByStorageName(arg)
+		if err != nil || f.UserID != userID {
+			return
+		}
+		b.saveState(statePassword, userID, arg)
+		msg := tgbotapi.NewMessage(q.Message.Chat.ID, "Введите пароль для скачивания (минимум 4 символа) или «-», чтобы снять пароль")
 		msg.ReplyMarkup = tgbotapi.ForceReply{ForceReply: true}
 		b.api.Send(msg)
+	case "oldlinks":
+		f, err := b.db.GetFileByStorageName(arg)
+		if err != nil || f.UserID != userID {
+			return
+		}
+		b.sendOldLinks(q.Message.Chat.ID, f)
+	case "unlink":
+		val, name, _ := strings.Cut(arg, ":")
+		id, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return
+		}
+		f, err := b.db.GetFileByStorageName(name)
+		if err != nil || f.UserID != userID {
+			return
+		}
+		if err := b.db.RevokeOldLink(f.ID, id); err != nil {
+			log.Println("db:", err)
+			b.api.Send(tgbotapi.NewCallback(q.ID, "Ошибка"))
+			return
+		}
+		b.api.Send(tgbotapi.NewCallback(q.ID, "Старая ссылка отключена"))
+		b.sendOldLinks(q.Message.Chat.ID, f)
+	case "aliases":
+		f, err := b.db.GetFileByStorageName(arg)
+		if err != nil || f.UserID != userID {
+			return
+		}
+		b.sendAliases(q.Message.Chat.ID, f)
+	case "addalias":
+		f, err := b.db.GetFileByStorageName(arg)
+		if err != nil || f.UserID != userID {
+			return
+		}
+		if err := b.db.LoadAliases(f); err != nil {
+			log.Println("db:", err)
+			return
+		}
+		if len(f.Aliases) >= maxAliases {
+			b.api.Send(tgbotapi.NewCallback(q.ID, fmt.Sprintf("Не больше %d псевдонимов", maxAliases)))
+			return
+		}
+		b.saveState(stateAlias, userID, arg)
+		b.askLink(q.Message.Chat.ID, userID, "Введите псевдоним или получите случайный")
+	case "unalias":
+		val, name, _ := strings.Cut(arg, ":")
+		id, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return
+		}
+		f, err := b.db.GetFileByStorageName(name)
+		if err != nil || f.UserID != userID {
+			return
+		}
+		if err := b.db.RemoveAlias(f.ID, id); err != nil {
+			log.Println("db:", err)
+			b.api.Send(tgbotapi.NewCallback(q.ID, "Ошибка"))
+			return
+		}
+		b.api.Send(tgbotapi.NewCallback(q.ID, "Псевдоним удалён"))
+		b.sendAliases(q.Message.Chat.ID, f)
+	case "replace":
+		f, err := b.db.GetFileByStorageName(arg)
+		if err != nil || f.UserID != userID {
+			return
+		}
+		b.saveState(stateReplace, userID, arg)
+		b.api.Send(tgbotapi.NewMessage(q.Message.Chat.ID, fmt.Sprintf(
+			"Отправьте новый файл для %s. Ссылки, настройки и журнал скачиваний сохранятся.\nЛюбое другое сообщение отменит замену", f.LocalName)))
+	case "versions":
+		f, err := b.db.GetFileByStorageName(arg)
+		if err != nil || f.UserID != userID {
+			return
+		}
+		b.sendVersions(q.Message.Chat.ID, f)
+	case "rollback":
+		val, name, _ := strings.Cut(arg, ":")
+		id, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return
+		}
+		f, err := b.db.GetFileByStorageName(name)
+		if err != nil || f.UserID != userID {
+			return
+		}
+		if err := b.db.RollbackVersion(f.ID, id); err != nil {
+			log.Println("db:", err)
+			b.api.Send(tgbotapi.NewCallback(q.ID, "Ошибка"))
+			return
+		}
+		b.api.Send(tgbotapi.NewCallback(q.ID, "Версия восстановлена"))
+		if f, err = b.db.GetFileByStorageName(name); err == nil {
+			b.sendVersions(q.Message.Chat.ID, f)
+		}
+	case "link":
+		b.saveState(stateLink, userID, arg)
+		b.askLink(q.Message.Chat.ID, userID, "Введите новую ссылку или получите случайную")
 	}
 }
 
 func (b *Bot) finishChangeLink(userID int64, name string, m *tgbotapi.Message) {
 	b.deleteMessage(m.Chat.ID, m.MessageID)
-	newLink := strings.TrimSpace(m.Text)
 	f, err := b.db.GetFileByStorageName(name)
 	if err != nil || f.UserID != userID {
-		delete(b.changeLink, userID)
+		b.clearState(stateLink, userID)
+		return
+	}
+	s, err := b.chooseSlug(m.Text)
+	if err != nil {
+		// the state is kept so the user can try again
+		b.askLink(m.Chat.ID, userID, slugError(err))
+		return
+	}
+	err = b.db.ChangeSlug(f.ID, s)
+	if err == db.ErrSlugTaken || err != nil && strings.Contains(err.Error(), "UNIQUE") {
+		b.askLink(m.Chat.ID, userID, "Ссылка уже занята, введите другую")
 		return
 	}
-	link := strings.TrimRight(b.cfg.Domain, "/") + "/" + newLink
-	_, err = b.db.Exec("UPDATE files SET link=? WHERE id=?", link, f.ID)
 	if err == nil {
-		msg := tgbotapi.NewMessage(m.Chat.ID, "Ссылка изменена: "+link)
+		msg := tgbotapi.NewMessage(m.Chat.ID, "Ссылка изменена: "+b.linkURL(s)+"\nСтарая ссылка перенаправляет на новую")
 		b.sendTemp(m.Chat.ID, userID, msg)
+	} else {
+		log.Println(err)
 	}
-	delete(b.changeLink, userID)
+	b.clearState(stateLink, userID)
+}
+
+// maxDescription limits the landing page description, in characters.
+const maxDescription = 1000
+
+func (b *Bot) finishSetDescription(userID int64, name string, m *tgbotapi.Message) {
+	b.deleteMessage(m.Chat.ID, m.MessageID)
+	b.clearState(stateDescription, userID)
+	f, err := b.db.GetFileByStorageName(name)
+	if err != nil || f.UserID != userID {
+		return
+	}
+	description := strings.TrimSpace(m.Text)
+	if description == "-" {
+		description = ""
+	}
+	if len([]rune(description)) > maxDescription {
+		b.sendTemp(m.Chat.ID, userID, tgbotapi.NewMessage(m.Chat.ID,
+			fmt.Sprintf("Описание длиннее %d символов", maxDescription)))
+		return
+	}
+	if err := b.db.SetDescription(f.ID, description); err != nil {
+		log.Println("db:", err)
+		return
+	}
+	b.sendTemp(m.Chat.ID, userID, tgbotapi.NewMessage(m.Chat.ID, "Описание сохранено"))
+}
+
+func (b *Bot) finishSetPassword(userID int64, name string, m *tgbotapi.Message) {
+	// the message holds the password in clear text
+	b.deleteMessage(m.Chat.ID, m.MessageID)
+	b.clearState(statePassword, userID)
+	f, err := b.db.GetFileByStorageName(name)
+	if err != nil || f.UserID != userID {
+		return
+	}
+	password := strings.TrimSpace(m.Text)
+	hash := ""
+	text := "Пароль снят"
+	if password != "-" {
+		if len([]rune(password)) < 4 {
+			b.sendTemp(m.Chat.ID, userID, tgbotapi.NewMessage(m.Chat.ID, "Пароль слишком короткий"))
+			return
+		}
+		h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			log.Println("bcrypt:", err)
+			return
+		}
+		hash = string(h)
+		text = "Пароль установлен"
+	}
+	if err := b.db.SetFilePassword(f.ID, hash); err != nil {
+		log.Println("db:", err)
+		return
+	}
+	b.sendTemp(m.Chat.ID, userID, tgbotapi.NewMessage(m.Chat.ID, text))
 }
 
 func (b *Bot) sendMainMenu(chatID, userID int64, isAdmin bool) {
@@ -801,9 +1128,9 @@ func (b *Bot) sendMainMenu(chatID, userID int64, isAdmin bool) {
 	if txt == "" {
 		txt = "\xF0\x9F\x92\xB0 Ваш баланс: %%bal%%\n\xF0\x9F\x93\x84 Загрузка: %%price%% USDT\n\xE2\x9E\x95 Возврат за удаление: %%refund%% USDT\nВыберите действие:"
 	}
-	txt = strings.ReplaceAll(txt, "%%bal%%", fmt.Sprintf("%.2f", bal))
-	txt = strings.ReplaceAll(txt, "%%price%%", fmt.Sprintf("%.2f", b.cfg.PriceUpload))
-	txt = strings.ReplaceAll(txt, "%%refund%%", fmt.Sprintf("%.2f", b.cfg.PriceRefund))
+	txt = strings.ReplaceAll(txt, "%%bal%%", bal.String())
+	txt = strings.ReplaceAll(txt, "%%price%%", b.cfg.PriceUpload.String())
+	txt = strings.ReplaceAll(txt, "%%refund%%", b.cfg.PriceRefund.String())
 	msg := tgbotapi.NewMessage(chatID, txt)
 	msg.ReplyMarkup = kb
 	b.sendTemp(chatID, userID, msg)
@@ -826,117 +1153,110 @@ func (b *Bot) sendAdminPanel(chatID, userID int64) {
 
 func (b *Bot) processTopup(userID int64, m *tgbotapi.Message, st *topupState) {
 	b.deleteMessage(m.Chat.ID, m.MessageID)
-	if st.step == 1 {
-		amountStr := strings.TrimSpace(m.Text)
-		var amount float64
-		fmt.Sscanf(amountStr, "%f", &amount)
-		if amount <= 0 || amount > 10000 {
-			if amount > 10000 {
+	providers := b.providers.Providers()
+	var provider payments.Provider
+	if st.Step == 1 {
+		amount, err := money.Parse(m.Text)
+		if err != nil || amount <= 0 || amount > maxTopup {
+			if amount > maxTopup {
 				msg := tgbotapi.NewMessage(m.Chat.ID, "Максимальная сумма 10000")
 				b.sendTemp(m.Chat.ID, userID, msg)
 			} else {
 				msg := tgbotapi.NewMessage(m.Chat.ID, "Неверная сумма")
 				b.sendTemp(m.Chat.ID, userID, msg)
 			}
-			delete(b.pendingTopup, userID)
+			b.clearState(stateTopup, userID)
 			return
 		}
-		st.amount = amount
-		if b.cfg.CryptoBotToken != "" && b.cfg.XRocketToken != "" {
-			st.step = 2
-			kb := tgbotapi.NewReplyKeyboard(
-				tgbotapi.NewKeyboardButtonRow(
-					tgbotapi.NewKeyboardButton("CryptoBot"),
-					tgbotapi.NewKeyboardButton("XRocket"),
-				),
-			)
+		st.Amount = amount
+		if len(providers) > 1 {
+			st.Step = 2
+			b.saveState(stateTopup, userID, st)
+			var row []tgbotapi.KeyboardButton
+			for _, p := range providers {
+				row = append(row, tgbotapi.NewKeyboardButton(p.Title()))
+			}
 			msg := tgbotapi.NewMessage(m.Chat.ID, "Выберите провайдера оплаты")
-			msg.ReplyMarkup = kb
+			msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(row)
 			b.sendTemp(m.Chat.ID, userID, msg)
 			return
 		}
-		provider := ""
-		if b.cfg.CryptoBotToken != "" {
-			provider = "crypto"
-		} else if b.cfg.XRocketToken != "" {
-			provider = "xrocket"
-		}
-		if provider == "" {
+		if len(providers) == 0 {
 			msg := tgbotapi.NewMessage(m.Chat.ID, "Нет провайдера оплаты")
 			b.sendTemp(m.Chat.ID, userID, msg)
-			delete(b.pendingTopup, userID)
+			b.clearState(stateTopup, userID)
 			return
 		}
-		if (provider == "crypto" && st.amount < b.cfg.CryptoMinTopup && b.cfg.CryptoMinTopup > 0) ||
-			(provider == "xrocket" && st.amount < b.cfg.XRocketMinTopup && b.cfg.XRocketMinTopup > 0) {
-			min := b.cfg.CryptoMinTopup
-			if provider == "xrocket" {
-				min = b.cfg.XRocketMinTopup
+		provider = providers[0]
+	} else if st.Step == 2 {
+		choice := strings.TrimSpace(m.Text)
+		for _, p := range providers {
+			if strings.EqualFold(choice, p.Title()) {
+				provider = p
 			}
-			msg := tgbotapi.NewMessage(m.Chat.ID, fmt.Sprintf("Минимальная сумма %.2f", min))
-			b.sendTemp(m.Chat.ID, userID, msg)
-			delete(b.pendingTopup, userID)
-			return
-		}
-		if err := b.finishInvoice(userID, m.Chat.ID, st.amount, provider); err != nil {
-			log.Println("invoice:", err)
-			msg := tgbotapi.NewMessage(m.Chat.ID, "Ошибка создания счёта")
-			b.sendTemp(m.Chat.ID, userID, msg)
-			delete(b.pendingTopup, userID)
-			return
 		}
-	} else if st.step == 2 {
-		provider := strings.ToLower(strings.TrimSpace(m.Text))
-		if provider == "cryptobot" {
-			provider = "crypto"
-		} else if provider == "xrocket" {
-			provider = "xrocket"
-		} else {
+		if provider == nil {
 			msg := tgbotapi.NewMessage(m.Chat.ID, "Неверный провайдер")
 			b.sendTemp(m.Chat.ID, userID, msg)
 			return
 		}
-		if (provider == "crypto" && st.amount < b.cfg.CryptoMinTopup && b.cfg.CryptoMinTopup > 0) ||
-			(provider == "xrocket" && st.amount < b.cfg.XRocketMinTopup && b.cfg.XRocketMinTopup > 0) {
-			min := b.cfg.CryptoMinTopup
-			if provider == "xrocket" {
-				min = b.cfg.XRocketMinTopup
-			}
-			msg := tgbotapi.NewMessage(m.Chat.ID, fmt.Sprintf("Минимальная сумма %.2f", min))
-			b.sendTemp(m.Chat.ID, userID, msg)
-			delete(b.pendingTopup, userID)
-			return
-		}
-		if err := b.finishInvoice(userID, m.Chat.ID, st.amount, provider); err != nil {
-			log.Println("invoice:", err)
-			msg := tgbotapi.NewMessage(m.Chat.ID, "Ошибка создания счёта")
-			b.sendTemp(m.Chat.ID, userID, msg)
-			delete(b.pendingTopup, userID)
-			return
-		}
+	} else {
+		return
+	}
+	if min := provider.MinTopup(); min > 0 && st.Amount < min {
+		msg := tgbotapi.NewMessage(m.Chat.ID, fmt.Sprintf("Минимальная сумма %s", min))
+		b.sendTemp(m.Chat.ID, userID, msg)
+		b.clearState(stateTopup, userID)
+		return
+	}
+	if err := b.finishInvoice(userID, m.Chat.ID, st.Amount, provider.Name()); err != nil {
+		log.Println("invoice:", err)
+		msg := tgbotapi.NewMessage(m.Chat.ID, "Ошибка создания счёта")
+		b.sendTemp(m.Chat.ID, userID, msg)
+		b.clearState(stateTopup, userID)
 	}
 }
 
-func (b *Bot) finishInvoice(userID int64, chatID int64, amount float64, provider string) error {
-	if amount > 10000 {
+func (b *Bot) finishInvoice(userID int64, chatID int64, amount money.Amount, provider string) error {
+	if amount > maxTopup {
 		return fmt.Errorf("amount limit")
 	}
-	url, id, prov, err := b.createInvoiceProvider(amount, provider)
+	p, err := b.providers.Get(provider)
 	if err != nil {
 		return err
 	}
 	rm := tgbotapi.NewMessage(chatID, " ")
 	rm.ReplyMarkup = tgbotapi.NewRemoveKeyboard(false)
+	// providers such as Telegram Stars post the invoice into the chat themselves
+	if ci, ok := p.(payments.ChatInvoicer); ok {
+		b.api.Send(rm)
+		b.deleteLast(userID, chatID)
+		inv, err := ci.SendInvoice(chatID, amount)
+		if err != nil {
+			return err
+		}
+		if _, err := b.db.AddInvoice(userID, inv.Amount, p.Name(), inv.ID); err != nil {
+			return err
+		}
+		b.clearState(stateTopup, userID)
+		return nil
+	}
+	inv, err := p.CreateInvoice(amount)
+	if err != nil {
+		return err
+	}
+	if _, err := b.db.AddInvoice(userID, inv.Amount, p.Name(), inv.ID); err != nil {
+		return err
+	}
 	b.api.Send(rm)
 	b.deleteLast(userID, chatID)
 	kb := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("\xE2\x9C\x85 Проверить оплату", "checkpay:"+id)),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("\xE2\x9C\x85 Проверить оплату", "checkpay:"+p.Name()+":"+inv.ID)),
 	)
-	msg := tgbotapi.NewMessage(chatID, "Оплатите: "+url)
+	msg := tgbotapi.NewMessage(chatID, "Оплатите: "+inv.URL)
 	msg.ReplyMarkup = kb
 	b.sendTemp(chatID, userID, msg)
-	b.pendingInvoices[id] = &invoiceState{userID: userID, amount: amount, provider: prov}
-	delete(b.pendingTopup, userID)
+	b.clearState(stateTopup, userID)
 	return nil
 }
 
@@ -989,6 +1309,23 @@ func (b *Bot) sendFileList(userID int64, chatID int64, page int) {
 	b.sendTemp(chatID, userID, msg)
 }
 
+// parseAdminAmount reads "<telegram id> <amount>" typed by an admin.
+func parseAdminAmount(text string) (int64, money.Amount, bool) {
+	f := strings.Fields(text)
+	if len(f) != 2 {
+		return 0, 0, false
+	}
+	tg, err := strconv.ParseInt(f[0], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	a, err := money.Parse(f[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	return tg, a, true
+}
+
 func (b *Bot) handleAdminInput(userID int64, act string, m *tgbotapi.Message) {
 	b.deleteMessage(m.Chat.ID, m.MessageID)
 	var resp tgbotapi.MessageConfig
@@ -998,34 +1335,38 @@ func (b *Bot) handleAdminInput(userID int64, act string, m *tgbotapi.Message) {
 		fmt.Sscanf(m.Text, "%d", &tg)
 		row := b.db.QueryRow("SELECT id, balance FROM users WHERE telegram_id=?", tg)
 		var id int64
-		var bal float64
+		var bal money.Amount
 		if err := row.Scan(&id, &bal); err != nil {
 			resp = tgbotapi.NewMessage(m.Chat.ID, "Пользователь не найден")
 		} else {
-			resp = tgbotapi.NewMessage(m.Chat.ID, fmt.Sprintf("ID: %d\nБаланс: %.2f", id, bal))
+			resp = tgbotapi.NewMessage(m.Chat.ID, fmt.Sprintf("ID: %d\nБаланс: %s", id, bal))
 		}
 	case "addbal":
-		var tg int64
-		var delta float64
-		fmt.Sscanf(m.Text, "%d %f", &tg, &delta)
+		tg, delta, ok := parseAdminAmount(m.Text)
 		row := b.db.QueryRow("SELECT id FROM users WHERE telegram_id=?", tg)
 		var id int64
-		if err := row.Scan(&id); err != nil {
+		if !ok {
+			resp = tgbotapi.NewMessage(m.Chat.ID, "Неверная сумма")
+		} else if err := row.Scan(&id); err != nil {
 			resp = tgbotapi.NewMessage(m.Chat.ID, "Пользователь не найден")
+		} else if err := b.db.AdjustBalance(id, delta); err != nil {
+			log.Println(err)
+			resp = tgbotapi.NewMessage(m.Chat.ID, "Баланс не может быть отрицательным")
 		} else {
-			b.db.AdjustBalance(id, delta)
 			resp = tgbotapi.NewMessage(m.Chat.ID, "Баланс изменён")
 		}
 	case "setbal":
-		var tg int64
-		var val float64
-		fmt.Sscanf(m.Text, "%d %f", &tg, &val)
+		tg, val, ok := parseAdminAmount(m.Text)
 		row := b.db.QueryRow("SELECT id FROM users WHERE telegram_id=?", tg)
 		var id int64
-		if err := row.Scan(&id); err != nil {
+		if !ok {
+			resp = tgbotapi.NewMessage(m.Chat.ID, "Неверная сумма")
+		} else if err := row.Scan(&id); err != nil {
 			resp = tgbotapi.NewMessage(m.Chat.ID, "Пользователь не найден")
+		} else if err := b.db.SetBalance(id, val); err != nil {
+			log.Println(err)
+			resp = tgbotapi.NewMessage(m.Chat.ID, "Баланс не может быть отрицательным")
 		} else {
-			b.db.SetBalance(id, val)
 			resp = tgbotapi.NewMessage(m.Chat.ID, "Баланс установлен")
 		}
 	}
@@ -1039,65 +1380,71 @@ func (b *Bot) handleAdminInput(userID int64, act string, m *tgbotapi.Message) {
 		}
 	}
 	b.sendAdminPanel(m.Chat.ID, userID)
-	delete(b.adminAction, userID)
+	b.clearState(stateAdmin, userID)
 }
 
 func (b *Bot) checkTokens() {
-	if b.cfg.CryptoBotToken != "" {
-		req, _ := http.NewRequest("GET", "https://pay.crypt.bot/api/getMe", nil)
-		req.Header.Set("Crypto-Pay-API-Token", b.cfg.CryptoBotToken)
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			log.Println("[CryptoBot]", err)
+	for _, p := range b.providers.Providers() {
+		if err := p.HealthCheck(); err != nil {
+			log.Printf("[%s] %v", p.Title(), err)
 		} else {
-			defer resp.Body.Close()
-			data, _ := io.ReadAll(resp.Body)
-			if resp.StatusCode == http.StatusOK {
-				log.Println("[CryptoBot] Success connected")
-			} else {
-				log.Printf("[CryptoBot] %s", strings.TrimSpace(string(data)))
-			}
+			log.Printf("[%s] Success connected", p.Title())
 		}
 	}
-	if b.cfg.XRocketToken != "" {
-		req, _ := http.NewRequest("GET", "https://pay.xrocket.tg/app/info", nil)
-		req.Header.Set("Rocket-Pay-Key", b.cfg.XRocketToken)
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			log.Println("[xRocket]", err)
-		} else {
-			defer resp.Body.Close()
-			data, _ := io.ReadAll(resp.Body)
-			if resp.StatusCode != http.StatusOK {
-				log.Printf("[xRocket] %s", strings.TrimSpace(string(data)))
-			} else {
-				var r struct {
-					Success bool `json:"success"`
-					Data    struct {
-						Name string `json:"name"`
-					} `json:"data"`
-				}
-				if err := json.Unmarshal(data, &r); err == nil && r.Success {
-					log.Printf("[xRocket] Success connected to shop %s", r.Data.Name)
-				} else {
-					log.Printf("[xRocket] %s", strings.TrimSpace(string(data)))
-				}
-			}
-		}
+}
+
+// parseTime reads a timestamp as returned by SQLite.
+func parseTime(s string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse("2006-01-02 15:04:05", s); err == nil {
+		return t, true
 	}
+	return time.Time{}, false
 }
 
-func buildLogHTML(f *models.File, entries []logdb.Entry) string {
+// eventNames are the log event titles shown to owners.
+var eventNames = map[string]string{
+	logdb.EventDownload:    "скачивание",
+	logdb.EventBadPassword: "неверный пароль",
+}
+
+func buildLogHTML(f *models.File, link string, entries []logdb.Entry, bySlug map[string]int) string {
 	var sb strings.Builder
 	sb.WriteString(`<!DOCTYPE html><html lang="ru"><head><meta charset="utf-8"><meta name="viewport" content="width=device-width,initial-scale=1"><title>Log</title><style>body{background:#111;color:#eee;font-family:sans-serif;padding:20px}table{width:100%;border-collapse:collapse}th,td{padding:8px;border:1px solid #444}th{background:#222}</style></head><body>`)
 	sb.WriteString(fmt.Sprintf("<h2>%s</h2>", f.LocalName))
-	sb.WriteString(fmt.Sprintf("<p>Ссылка: %s</p>", f.Link))
-	sb.WriteString(fmt.Sprintf("<p>Количество скачиваний: %d</p>", len(entries)))
-	sb.WriteString("<table><tr><th>#</th><th>IP</th><th>Страна</th><th>Город</th><th>Платформа</th><th>Модель</th><th>ОС</th><th>Браузер</th><th>Дата</th></tr>")
+	sb.WriteString(fmt.Sprintf("<p>Ссылка: %s</p>", link))
+	downloads := 0
+	for _, e := range entries {
+		if e.Event == logdb.EventDownload && !e.Bot {
+			downloads++
+		}
+	}
+	sb.WriteString(fmt.Sprintf("<p>Количество скачиваний: %d</p>", downloads))
+	if len(bySlug) > 1 {
+		slugs := make([]string, 0, len(bySlug))
+		for s := range bySlug {
+			slugs = append(slugs, s)
+		}
+		sort.Strings(slugs)
+		sb.WriteString("<p>По ссылкам:")
+		for _, s := range slugs {
+			sb.WriteString(fmt.Sprintf(" %s — %d;", s, bySlug[s]))
+		}
+		sb.WriteString("</p>")
+	}
+	sb.WriteString("<table><tr><th>#</th><th>Событие</th><th>Ссылка</th><th>IP</th><th>Страна</th><th>Город</th><th>Платформа</th><th>Модель</th><th>ОС</th><th>Браузер</th><th>Дата</th></tr>")
 	loc, _ := time.LoadLocation("Europe/Moscow")
 	for i, e := range entries {
 		sb.WriteString("<tr>")
 		sb.WriteString(fmt.Sprintf("<td>%d</td>", i+1))
+		event := eventNames[e.Event]
+		if e.Bot {
+			event += " (бот)"
+		}
+		sb.WriteString(fmt.Sprintf("<td>%s</td>", event))
+		sb.WriteString(fmt.Sprintf("<td>%s</td>", e.Slug))
 		sb.WriteString(fmt.Sprintf("<td>%s</td>", e.IP))
 		sb.WriteString(fmt.Sprintf("<td>%s</td>", e.Country))
 		sb.WriteString(fmt.Sprintf("<td>%s</td>", e.City))
@@ -1106,9 +1453,7 @@ func buildLogHTML(f *models.File, entries []logdb.Entry) string {
 		sb.WriteString(fmt.Sprintf("<td>%s %s</td>", e.OSName, e.OSVersion))
 		sb.WriteString(fmt.Sprintf("<td>%s %s</td>", e.BrowserName, e.BrowserVer))
 		ts := e.CreatedAt
-		if t, err := time.Parse(time.RFC3339, ts); err == nil {
-			ts = t.In(loc).Format("02.01.2006 15:04:05")
-		} else if t, err := time.Parse("2006-01-02 15:04:05", ts); err == nil {
+		if t, ok := parseTime(ts); ok {
 			ts = t.In(loc).Format("02.01.2006 15:04:05")
 		}
 		sb.WriteString(fmt.Sprintf("<td>%s</td>", ts))
@@ -0,0 +1,191 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/example/filestoragebot/models"
+	"github.com/example/filestoragebot/money"
+)
+
+const janitorInterval = 10 * time.Minute
+
+// deadGrace is how long a dead file is kept so that a download started just
+// before its link died can finish.
+const deadGrace = 6 * time.Hour
+
+// Link lifetimes offered in the upload wizard and the file keyboard.
+var expiryChoices = []struct {
+	Label string
+	Days  int
+}{
+	{"Бессрочно", 0},
+	{"1 день", 1},
+	{"7 дней", 7},
+	{"30 дней", 30},
+}
+
+// Download limits offered in the upload wizard and the file keyboard.
+var limitChoices = []struct {
+	Label string
+	Max   int
+}{
+	{"Без ограничений", 0},
+	{"1", 1},
+	{"10", 10},
+	{"100", 100},
+}
+
+// Lifetimes offered for signed URLs.
+var signChoices = []struct {
+	Label string
+	Hours int
+}{
+	{"1 час", 1},
+	{"1 день", 24},
+	{"7 дней", 7 * 24},
+	{"30 дней", 30 * 24},
+}
+
+// parseExpiry reads a link lifetime typed by the user: one of the offered
+// labels or a number of days.
+func parseExpiry(text string) (int, bool) {
+	text = strings.TrimSpace(text)
+	for _, c := range expiryChoices {
+		if strings.EqualFold(text, c.Label) {
+			return c.Days, true
+		}
+	}
+	days, err := strconv.Atoi(text)
+	if err != nil || days < 0 || days > 3650 {
+		return 0, false
+	}
+	return days, true
+}
+
+// parseLimit reads a download limit typed by the user.
+func parseLimit(text string) (int, bool) {
+	text = strings.TrimSpace(text)
+	for _, c := range limitChoices {
+		if strings.EqualFold(text, c.Label) {
+			return c.Max, true
+		}
+	}
+	n, err := strconv.Atoi(text)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// expiresAt converts a lifetime in days into the unix time stored with the
+// file.
+func expiresAt(days int) int64 {
+	if days == 0 {
+		return 0
+	}
+	return time.Now().Add(time.Duration(days) * 24 * time.Hour).Unix()
+}
+
+// describeLimits renders the lifetime and download limit of f for the file
+// menu.
+func describeLimits(f *models.File) string {
+	expiry := "бессрочно"
+	if f.ExpiresAt > 0 {
+		expiry = "до " + time.Unix(f.ExpiresAt, 0).UTC().Format("02.01.2006 15:04") + " UTC"
+	}
+	limit := "без ограничений"
+	if f.MaxDownloads > 0 {
+		limit = fmt.Sprintf("%d из %d", f.Downloads, f.MaxDownloads)
+	}
+	text := fmt.Sprintf("⏳ Ссылка: %s\n⬇️ Скачивания: %s", expiry, limit)
+	if f.Consumed {
+		text += "\n🔥 Одноразовая ссылка использована"
+	} else if f.OneTime {
+		text += "\n🔥 Одноразовая ссылка"
+	}
+	if f.SignedOnly {
+		text += "\n✍️ Только подписанные ссылки"
+	}
+	return text
+}
+
+// removeFile deletes the record, contents, old versions and download log
+// of f. It reports false if the record was already gone, e.g. when a manual
+// delete races the janitor; only the caller that removed it may refund.
+func (b *Bot) removeFile(f *models.File) bool {
+	versions, err := b.db.ListVersions(f.ID)
+	if err != nil {
+		log.Println("db:", err)
+	}
+	removed, err := b.db.DeleteFile(f.ID)
+	if err != nil {
+		log.Println("db:", err)
+	}
+	if !removed {
+		return false
+	}
+	if err := b.store.Delete(f.Blob); err != nil {
+		log.Println("storage:", err)
+	}
+	for _, v := range versions {
+		if err := b.store.Delete(v.Blob); err != nil {
+			log.Println("storage:", err)
+		}
+	}
+	if err := b.logs.Drop(f.ID); err != nil {
+		log.Println("logdb:", err)
+	}
+	return true
+}
+
+// expiredRefund returns how much is given back for a file removed because its
+// link expired, following the expired_refund policy.
+func (b *Bot) expiredRefund(f *models.File) money.Amount {
+	switch b.cfg.ExpiredRefund {
+	case "refund":
+		return b.cfg.PriceRefund
+	case "unused":
+		if f.Downloads == 0 {
+			return b.cfg.PriceRefund
+		}
+	}
+	return 0
+}
+
+// janitor periodically removes files whose links expired or ran out of
+// downloads.
+func (b *Bot) janitor() {
+	for {
+		b.removeDeadFiles()
+		time.Sleep(janitorInterval)
+	}
+}
+
+func (b *Bot) removeDeadFiles() {
+	files, err := b.db.ListDeadFiles(deadGrace)
+	if err != nil {
+		log.Println("janitor:", err)
+		return
+	}
+	for i := range files {
+		f := &files[i]
+		if !b.removeFile(f) {
+			continue
+		}
+		text := fmt.Sprintf("\xE2\x8C\x9B Ссылка на файл %s больше не действует, файл удалён", f.LocalName)
+		if refund := b.expiredRefund(f); refund > 0 {
+			if err := b.db.AdjustBalance(f.UserID, refund); err != nil {
+				log.Println("janitor:", err)
+			} else {
+				text += fmt.Sprintf(". Возвращено %s USDT", refund)
+			}
+		}
+		if err := b.Notify(f.UserID, text); err != nil {
+			log.Println("notify:", err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/example/filestoragebot/models"
+	"github.com/example/filestoragebot/slug"
+)
+
+// randomLink is the keyboard button that asks for a generated link.
+const randomLink = "\xF0\x9F\x8E\xB2 Случайная"
+
+// linkURL returns the public address of a slug.
+func (b *Bot) linkURL(s string) string {
+	return strings.TrimRight(b.cfg.Domain, "/") + "/" + s
+}
+
+// askLink prompts for the link part, offering a random one.
+func (b *Bot) askLink(chatID, userID int64, text string) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	kb := tgbotapi.NewReplyKeyboard(tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButton(randomLink)))
+	kb.OneTimeKeyboard = true
+	msg.ReplyMarkup = kb
+	b.sendTemp(chatID, userID, msg)
+}
+
+// chooseSlug turns the user's answer into a slug that passes the policy,
+// generating a free one for the random button.
+func (b *Bot) chooseSlug(text string) (string, error) {
+	if strings.TrimSpace(text) == randomLink {
+		return slug.Random(func(s string) (bool, error) {
+			return b.db.SlugTaken(s)
+		})
+	}
+	return slug.Normalize(text)
+}
+
+// slugError explains why a link part was rejected.
+func slugError(err error) string {
+	switch err {
+	case slug.ErrLength:
+		return fmt.Sprintf("Ссылка должна быть от %d до %d символов", slug.MinLength, slug.MaxLength)
+	case slug.ErrCharset:
+		return "В ссылке допустимы только латинские буквы, цифры, «-» и «_» (не в начале и не в конце)"
+	case slug.ErrReserved:
+		return "Эта ссылка зарезервирована, выберите другую"
+	}
+	return "Не удалось подобрать ссылку, попробуйте ещё раз"
+}
+
+// sendOldLinks lists the old links of f with buttons to revoke them.
+func (b *Bot) sendOldLinks(chatID int64, f *models.File) {
+	old, err := b.db.ListOldLinks(f.ID)
+	if err != nil {
+		log.Println("db:", err)
+		return
+	}
+	if len(old) == 0 {
+		b.api.Send(tgbotapi.NewMessage(chatID, "Старых ссылок нет"))
+		return
+	}
+	var sb strings.Builder
+	sb.WriteString("Старые ссылки перенаправляют на " + b.linkURL(f.Slug) + ":\n")
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, l := range old {
+		sb.WriteString(b.linkURL(l.Slug) + "\n")
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			"❌ "+l.Slug, fmt.Sprintf("unlink:%d:%s", l.ID, f.StorageName))))
+	}
+	if len(old) > 1 {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			"❌ Отключить все", "unlink:0:"+f.StorageName)))
+	}
+	msg := tgbotapi.NewMessage(chatID, sb.String())
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	b.api.Send(msg)
+}
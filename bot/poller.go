@@ -0,0 +1,79 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/example/filestoragebot/models"
+)
+
+func (b *Bot) invoiceTimeout() time.Duration {
+	if b.cfg.InvoiceTimeout <= 0 {
+		return time.Hour
+	}
+	return time.Duration(b.cfg.InvoiceTimeout) * time.Minute
+}
+
+func (b *Bot) pollInterval() time.Duration {
+	if b.cfg.InvoicePoll <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(b.cfg.InvoicePoll) * time.Second
+}
+
+// pollInvoices credits invoices paid without pressing the check button and
+// expires the ones left unpaid for longer than invoice_timeout.
+func (b *Bot) pollInvoices() {
+	for {
+		b.checkPendingInvoices()
+		time.Sleep(b.pollInterval())
+	}
+}
+
+func (b *Bot) checkPendingInvoices() {
+	list, err := b.db.ListPendingPayments()
+	if err != nil {
+		log.Println("poll invoices:", err)
+		return
+	}
+	deadline := time.Now().Add(-b.invoiceTimeout())
+	for _, p := range list {
+		// Stars cannot be polled and are credited by successful_payment,
+		// which may arrive after the timeout; they are never expired
+		if p.Provider == "stars" {
+			continue
+		}
+		paid, err := b.checkInvoice(p.InvoiceID, p.Provider)
+		if err != nil {
+			// an invoice is only expired once the provider says it is unpaid
+			log.Printf("poll invoice %s/%s: %v", p.Provider, p.InvoiceID, err)
+			continue
+		}
+		if paid {
+			paidPayment, credited, err := b.db.CreditInvoice(p.Provider, p.InvoiceID)
+			if err != nil {
+				log.Println("credit invoice:", err)
+			} else if credited {
+				b.NotifyCredited(paidPayment)
+			}
+			continue
+		}
+		created, ok := parseTime(p.CreatedAt)
+		if !ok || created.After(deadline) {
+			continue
+		}
+		if expired, err := b.db.ExpirePayment(p.ID); err != nil {
+			log.Println("expire invoice:", err)
+		} else if expired {
+			b.Notify(p.UserID, fmt.Sprintf("\xE2\x8C\x9B Счёт на %s USDT истёк", p.Amount))
+		}
+	}
+}
+
+// NotifyCredited tells the user that an invoice has been credited.
+func (b *Bot) NotifyCredited(p *models.Payment) {
+	if err := b.Notify(p.UserID, fmt.Sprintf("\xE2\x9C\x85 Баланс пополнен на %s USDT", p.Amount)); err != nil {
+		log.Println("notify:", err)
+	}
+}
@@ -0,0 +1,91 @@
+package bot
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/example/filestoragebot/config"
+	"github.com/example/filestoragebot/db"
+	"github.com/example/filestoragebot/models"
+	"github.com/example/filestoragebot/money"
+	"github.com/example/filestoragebot/payments"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fakeProvider reports invoices from paid as paid and fails for those in
+// broken.
+type fakeProvider struct {
+	paid, broken map[string]bool
+}
+
+func (p *fakeProvider) Name() string           { return "fake" }
+func (p *fakeProvider) Title() string          { return "Fake" }
+func (p *fakeProvider) MinTopup() money.Amount { return 0 }
+func (p *fakeProvider) CreateInvoice(money.Amount) (*payments.Invoice, error) {
+	return nil, errors.New("fake")
+}
+func (p *fakeProvider) HealthCheck() error { return nil }
+
+func (p *fakeProvider) CheckInvoice(id string) (bool, error) {
+	if p.broken[id] {
+		return false, errors.New("provider unavailable")
+	}
+	return p.paid[id], nil
+}
+
+func TestCheckPendingInvoices(t *testing.T) {
+	database, err := db.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	userID, err := database.GetOrCreateUser(1)
+	if err != nil {
+		t.Fatalf("GetOrCreateUser: %v", err)
+	}
+	for _, id := range []string{"paid", "unpaid", "broken"} {
+		if _, err := database.AddInvoice(userID, money.USDT, "fake", id); err != nil {
+			t.Fatalf("AddInvoice: %v", err)
+		}
+	}
+	// all invoices are past invoice_timeout
+	if _, err := database.Exec("UPDATE payments SET created_at='2000-01-01 00:00:00'"); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent++
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1,"chat":{"id":1}}}`))
+	}))
+	defer ts.Close()
+	api := &tgbotapi.BotAPI{Token: "test", Client: ts.Client(), Buffer: 1}
+	api.SetAPIEndpoint(ts.URL + "/bot%s/%s")
+
+	fake := &fakeProvider{paid: map[string]bool{"paid": true}, broken: map[string]bool{"broken": true}}
+	b := &Bot{api: api, cfg: &config.Config{}, db: database, providers: payments.NewRegistry(fake)}
+	b.checkPendingInvoices()
+
+	want := map[string]string{
+		"paid":   models.PaymentPaid,
+		"unpaid": models.PaymentExpired,
+		"broken": models.PaymentPending,
+	}
+	for id, status := range want {
+		p, err := database.GetPaymentByInvoice("fake", id)
+		if err != nil {
+			t.Fatalf("GetPaymentByInvoice %s: %v", id, err)
+		}
+		if p.Status != status {
+			t.Errorf("%s: status %q, want %q", id, p.Status, status)
+		}
+	}
+	if bal, _ := database.GetBalance(userID); bal != money.USDT {
+		t.Errorf("balance %s, want 1", bal)
+	}
+	if sent != 2 {
+		t.Errorf("sent %d notifications, want 2", sent)
+	}
+}
@@ -0,0 +1,53 @@
+package bot
+
+import (
+	"log"
+
+	"github.com/example/filestoragebot/models"
+	"github.com/example/filestoragebot/payments"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func (b *Bot) starsProvider() *payments.Stars {
+	p, err := b.providers.Get("stars")
+	if err != nil {
+		return nil
+	}
+	s, _ := p.(*payments.Stars)
+	return s
+}
+
+// handlePreCheckout confirms a Stars payment only for a pending invoice of
+// the same user and amount. Telegram expects the answer within 10 seconds.
+func (b *Bot) handlePreCheckout(q *tgbotapi.PreCheckoutQuery) {
+	ok := false
+	if s := b.starsProvider(); s != nil {
+		p, err := b.db.GetPaymentByInvoice(s.Name(), q.InvoicePayload)
+		if err == nil && p.Status == models.PaymentPending && s.ValidCheckout(p.Amount, q.Currency, q.TotalAmount) {
+			if tg, err := b.db.GetTelegramID(p.UserID); err == nil && q.From != nil && tg == q.From.ID {
+				ok = true
+			}
+		}
+	}
+	answer := tgbotapi.PreCheckoutConfig{PreCheckoutQueryID: q.ID, OK: ok}
+	if !ok {
+		answer.ErrorMessage = "Счёт не найден или уже закрыт"
+	}
+	if _, err := b.api.Request(answer); err != nil {
+		log.Println("pre checkout:", err)
+	}
+}
+
+// handleSuccessfulPayment credits a Stars payment. Telegram has already taken
+// the stars at this point, so the invoice is credited even if it expired
+// after the pre-checkout.
+func (b *Bot) handleSuccessfulPayment(sp *tgbotapi.SuccessfulPayment) {
+	p, credited, err := b.db.CreditCapturedInvoice("stars", sp.InvoicePayload)
+	if err != nil {
+		log.Printf("[Telegram Stars] credit %s (charge %s): %v", sp.InvoicePayload, sp.TelegramPaymentChargeID, err)
+		return
+	}
+	if credited {
+		b.NotifyCredited(p)
+	}
+}
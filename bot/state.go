@@ -0,0 +1,77 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Kinds of conversational state kept in the database so that a restart does
+// not interrupt wizards.
+const (
+	stateUpload = "upload"
+	stateLink   = "link"
+	stateTopup  = "topup"
+	stateAdmin  = "admin"
+	statePage   = "page"
+	// statePassword holds the storage name of the file whose password is
+	// being set.
+	statePassword = "password"
+	// stateDescription holds the storage name of the file whose landing
+	// page description is being edited.
+	stateDescription = "description"
+	// stateAlias holds the storage name of the file an alias is being
+	// added to.
+	stateAlias = "alias"
+	// stateReplace holds the storage name of the file waiting for new
+	// contents.
+	stateReplace = "replace"
+)
+
+var stateTTL = map[string]time.Duration{
+	stateUpload:      24 * time.Hour,
+	stateLink:        time.Hour,
+	stateTopup:       time.Hour,
+	stateAdmin:       time.Hour,
+	statePage:        24 * time.Hour,
+	statePassword:    time.Hour,
+	stateDescription: time.Hour,
+	stateAlias:       time.Hour,
+	stateReplace:     10 * time.Minute,
+}
+
+func (b *Bot) loadState(kind string, key interface{}, v interface{}) bool {
+	ok, err := b.db.LoadState(kind, fmt.Sprint(key), v)
+	if err != nil {
+		log.Println("state:", err)
+	}
+	return ok
+}
+
+func (b *Bot) saveState(kind string, key interface{}, v interface{}) {
+	if err := b.db.SaveState(kind, fmt.Sprint(key), v, stateTTL[kind]); err != nil {
+		log.Println("state:", err)
+	}
+}
+
+func (b *Bot) clearState(kind string, key interface{}) {
+	if err := b.db.DeleteState(kind, fmt.Sprint(key)); err != nil {
+		log.Println("state:", err)
+	}
+}
+
+// purgeState periodically removes expired state records and releases the
+// balance held by uploads that were abandoned with them.
+func (b *Bot) purgeState() {
+	for {
+		if _, err := b.db.PurgeState(); err != nil {
+			log.Println("state:", err)
+		}
+		if n, err := b.db.ReleaseStaleReservations(stateTTL[stateUpload]); err != nil {
+			log.Println("reservations:", err)
+		} else if n > 0 {
+			log.Printf("reservations: released %d stale holds", n)
+		}
+		time.Sleep(time.Hour)
+	}
+}
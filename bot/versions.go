@@ -0,0 +1,103 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/example/filestoragebot/models"
+)
+
+// finishReplace stores the document in m as the new contents of a file. The
+// replacement is free, so it may not be larger than what the upload paid
+// for.
+func (b *Bot) finishReplace(userID int64, name string, m *tgbotapi.Message) {
+	b.clearState(stateReplace, userID)
+	b.deleteMessage(m.Chat.ID, m.MessageID)
+	f, err := b.db.GetFileByStorageName(name)
+	if err != nil || f.UserID != userID {
+		return
+	}
+	size := int64(m.Document.FileSize)
+	limit := b.cfg.MaxFileSize
+	if f.Size > limit {
+		limit = f.Size
+	}
+	if l := b.fileLimit(); l < limit {
+		limit = l
+	}
+	if size > limit {
+		b.sendTemp(m.Chat.ID, userID, tgbotapi.NewMessage(m.Chat.ID,
+			fmt.Sprintf("\xE2\x9D\x8C Файл слишком большой для замены, максимум %d МБ. Загрузите его как новый файл", limit/(1024*1024))))
+		return
+	}
+
+	blob := fmt.Sprintf("%d_%d", userID, rand.Int63())
+	if err := b.storeTelegramFile(m.Document.FileID, blob); err != nil {
+		log.Println(err)
+		b.sendTemp(m.Chat.ID, userID, tgbotapi.NewMessage(m.Chat.ID, "Ошибка сохранения"))
+		return
+	}
+	drop, err := b.db.ReplaceBlob(f.ID, blob, m.Document.FileName, size, b.cfg.KeepVersions)
+	if err != nil {
+		log.Println("db:", err)
+		b.store.Delete(blob)
+		b.sendTemp(m.Chat.ID, userID, tgbotapi.NewMessage(m.Chat.ID, "Ошибка сохранения"))
+		return
+	}
+	for _, d := range drop {
+		if err := b.store.Delete(d); err != nil {
+			log.Println("storage:", err)
+		}
+	}
+	b.sendTemp(m.Chat.ID, userID, tgbotapi.NewMessage(m.Chat.ID,
+		fmt.Sprintf("Файл %s заменён, ссылка прежняя: %s", f.LocalName, b.linkURL(f.Slug))))
+}
+
+// sendVersions lists the kept previous contents of f with rollback buttons.
+func (b *Bot) sendVersions(chatID int64, f *models.File) {
+	versions, err := b.db.ListVersions(f.ID)
+	if err != nil {
+		log.Println("db:", err)
+		return
+	}
+	if len(versions) == 0 {
+		text := "Предыдущих версий нет"
+		if b.cfg.KeepVersions <= 0 {
+			text += ", хранение версий отключено"
+		}
+		b.api.Send(tgbotapi.NewMessage(chatID, text))
+		return
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Сейчас: %s, %s\nПредыдущие версии:\n", versionName(f.FileName, f.LocalName), megabytes(f.Size)))
+	var rows [][]tgbotapi.InlineKeyboardButton
+	loc, _ := time.LoadLocation("Europe/Moscow")
+	for i, v := range versions {
+		replaced := v.CreatedAt
+		if t, ok := parseTime(replaced); ok {
+			replaced = t.In(loc).Format("02.01.2006 15:04")
+		}
+		sb.WriteString(fmt.Sprintf("%d. %s, %s, заменена %s\n", i+1, versionName(v.FileName, f.LocalName), megabytes(v.Size), replaced))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			fmt.Sprintf("↩️ Вернуть %d", i+1), fmt.Sprintf("rollback:%d:%s", v.ID, f.StorageName))))
+	}
+	msg := tgbotapi.NewMessage(chatID, sb.String())
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	b.api.Send(msg)
+}
+
+func versionName(fileName, fallback string) string {
+	if fileName == "" {
+		return fallback
+	}
+	return fileName
+}
+
+func megabytes(size int64) string {
+	return fmt.Sprintf("%.1f МБ", float64(size)/(1024*1024))
+}
@@ -8,8 +8,11 @@ import (
 	"github.com/example/filestoragebot/bot"
 	"github.com/example/filestoragebot/config"
 	"github.com/example/filestoragebot/db"
+	"github.com/example/filestoragebot/geoip"
 	"github.com/example/filestoragebot/logdb"
+	"github.com/example/filestoragebot/payments"
 	"github.com/example/filestoragebot/server"
+	"github.com/example/filestoragebot/storage"
 	"github.com/example/filestoragebot/version"
 )
 
@@ -36,21 +39,37 @@ func main() {
 	if err != nil {
 		log.Fatalf("database: %v", err)
 	}
+	if n, err := database.MigrateLinks(cfg.Domain); err != nil {
+		log.Fatalf("database: %v", err)
+	} else if n > 0 {
+		log.Printf("Converted %d file links to slugs", n)
+	}
 
 	logs, err := logdb.New(cfg.LogsDatabasePath)
 	if err != nil {
 		log.Fatalf("logs database: %v", err)
 	}
 
-	b, err := bot.New(cfg, database, logs)
+	store, err := storage.New(cfg)
+	if err != nil {
+		log.Fatalf("storage: %v", err)
+	}
+
+	providers := payments.FromConfig(cfg)
+	geo, err := geoip.FromConfig(cfg)
+	if err != nil {
+		log.Fatalf("geoip: %v", err)
+	}
+
+	b, err := bot.New(cfg, database, logs, store, providers)
 	if err != nil {
 		log.Fatalf("bot: %v", err)
 	}
 
 	go func() {
-		if err := server.Start(cfg, database, logs, func(id int64, msg string) {
+		if err := server.Start(cfg, database, logs, store, providers, geo, func(id int64, msg string) {
 			_ = b.Notify(id, msg)
-		}); err != nil {
+		}, b.NotifyCredited); err != nil {
 			log.Fatalf("server: %v", err)
 		}
 	}()
@@ -1,29 +1,59 @@
 package config
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
 	"os"
+
+	"github.com/example/filestoragebot/money"
 )
 
 type Config struct {
-	TelegramToken    string  `yaml:"telegram_token"`
-	CryptoBotToken   string  `yaml:"cryptobot_token"`
-	XRocketToken     string  `yaml:"xrocket_token"`
-	CryptoMinTopup   float64 `yaml:"cryptobot_min_topup"`
-	XRocketMinTopup  float64 `yaml:"xrocket_min_topup"`
-	DatabasePath     string  `yaml:"database_path"`
-	LogsDatabasePath string  `yaml:"logs_database_path"`
-	FileStoragePath  string  `yaml:"file_storage_path"`
-	MaxFileSize      int64   `yaml:"max_file_size"`
-	Domain           string  `yaml:"domain"`
-	HTTPAddress      string  `yaml:"http_address"`
-	TLSCert          string  `yaml:"tls_cert"`
-	TLSKey           string  `yaml:"tls_key"`
-	AdminID          int64   `yaml:"admin_id"`
-	PriceUpload      float64 `yaml:"price_upload"`
-	PriceRefund      float64 `yaml:"price_refund"`
-	MenuText         string  `yaml:"menu_text"`
+	TelegramToken    string       `yaml:"telegram_token"`
+	TelegramAPIURL   string       `yaml:"telegram_api_url"`
+	TelegramLocal    bool         `yaml:"telegram_local_mode"`
+	CryptoBotToken   string       `yaml:"cryptobot_token"`
+	XRocketToken     string       `yaml:"xrocket_token"`
+	CryptoMinTopup   money.Amount `yaml:"cryptobot_min_topup"`
+	XRocketMinTopup  money.Amount `yaml:"xrocket_min_topup"`
+	StarsRate        money.Amount `yaml:"stars_rate"`
+	StarsMinTopup    money.Amount `yaml:"stars_min_topup"`
+	InvoicePoll      int          `yaml:"invoice_poll_interval"`
+	InvoiceTimeout   int          `yaml:"invoice_timeout"`
+	DatabasePath     string       `yaml:"database_path"`
+	LogsDatabasePath string       `yaml:"logs_database_path"`
+	FileStoragePath  string       `yaml:"file_storage_path"`
+	StorageBackend   string       `yaml:"storage_backend"`
+	S3Endpoint       string       `yaml:"s3_endpoint"`
+	S3Region         string       `yaml:"s3_region"`
+	S3Bucket         string       `yaml:"s3_bucket"`
+	S3AccessKey      string       `yaml:"s3_access_key"`
+	S3SecretKey      string       `yaml:"s3_secret_key"`
+	GeoIPDatabase    string       `yaml:"geoip_database"`
+	IPInfoEnabled    *bool        `yaml:"ipinfo_enabled"`
+	IPInfoToken      string       `yaml:"ipinfo_token"`
+	DownloadQueue    int          `yaml:"download_queue"`
+	InlineMIMETypes  []string     `yaml:"inline_mime_types"`
+	BotUserAgents    []string     `yaml:"bot_user_agents"`
+	BotNetworks      []string     `yaml:"bot_networks"`
+	MaxFileSize      int64        `yaml:"max_file_size"`
+	Domain           string       `yaml:"domain"`
+	ServedHosts      []string     `yaml:"served_hosts"`
+	MovedLinks       string       `yaml:"moved_links"`
+	HTTPAddress      string       `yaml:"http_address"`
+	ServerSecret     string       `yaml:"server_secret"`
+	TrustedProxies   []string     `yaml:"trusted_proxies"`
+	TLSCert          string       `yaml:"tls_cert"`
+	TLSKey           string       `yaml:"tls_key"`
+	AdminID          int64        `yaml:"admin_id"`
+	PriceUpload      money.Amount `yaml:"price_upload"`
+	PriceRefund      money.Amount `yaml:"price_refund"`
+	ExpiredRefund    string       `yaml:"expired_refund"`
+	OneTimeDelete    *bool        `yaml:"one_time_delete"`
+	KeepVersions     int          `yaml:"keep_versions"`
+	MenuText         string       `yaml:"menu_text"`
 }
 
 func Load(path string) (*Config, error) {
@@ -50,21 +80,38 @@ func Ensure(path string) (*Config, error) {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		cfg := &Config{
 			TelegramToken:    "",
+			TelegramAPIURL:   "",
+			TelegramLocal:    false,
 			CryptoBotToken:   "",
 			XRocketToken:     "",
-			CryptoMinTopup:   0.1,
-			XRocketMinTopup:  0.1,
+			CryptoMinTopup:   money.USDT / 10,
+			XRocketMinTopup:  money.USDT / 10,
+			StarsRate:        0,
+			StarsMinTopup:    money.USDT / 10,
+			InvoicePoll:      30,
+			InvoiceTimeout:   60,
 			DatabasePath:     "filestorage.db",
 			LogsDatabasePath: "logs.db",
 			FileStoragePath:  "files",
+			StorageBackend:   "local",
+			S3Region:         "us-east-1",
+			GeoIPDatabase:    "",
+			IPInfoEnabled:    new(bool),
+			DownloadQueue:    1024,
 			MaxFileSize:      100 * 1024 * 1024,
 			Domain:           "http://localhost:8080",
 			HTTPAddress:      ":8080",
+			MovedLinks:       "redirect",
+			ServerSecret:     randomSecret(),
+			TrustedProxies:   []string{"127.0.0.0/8", "::1/128"},
 			TLSCert:          "",
 			TLSKey:           "",
 			AdminID:          0,
-			PriceUpload:      1.0,
-			PriceRefund:      0.5,
+			PriceUpload:      money.USDT,
+			PriceRefund:      money.USDT / 2,
+			ExpiredRefund:    "none",
+			OneTimeDelete:    enabled(),
+			KeepVersions:     0,
 			MenuText:         "\xF0\x9F\x92\xB0 Ваш баланс: %%bal%%\n\xF0\x9F\x93\x84 Загрузка: %%price%% USDT\n\xE2\x9E\x95 Возврат за удаление: %%refund%% USDT\nВыберите действие:",
 		}
 		if err := cfg.Save(path); err != nil {
@@ -72,5 +119,42 @@ func Ensure(path string) (*Config, error) {
 		}
 		return cfg, nil
 	}
-	return Load(path)
+	cfg, err := Load(path)
+	if err != nil {
+		return cfg, err
+	}
+	// configs written before server_secret existed get one generated once
+	if cfg.ServerSecret == "" {
+		cfg.ServerSecret = randomSecret()
+		if err := cfg.Save(path); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// IPInfo reports whether ipinfo.io lookups are enabled. Configs written
+// before ipinfo_enabled existed keep using it, as they always did.
+func (c *Config) IPInfo() bool {
+	return c.IPInfoEnabled == nil || *c.IPInfoEnabled
+}
+
+// DeleteOneTime reports whether the blob of a used one-time link is removed.
+// It defaults to true when one_time_delete is missing from the config.
+func (c *Config) DeleteOneTime() bool {
+	return c.OneTimeDelete == nil || *c.OneTimeDelete
+}
+
+func enabled() *bool {
+	v := true
+	return &v
+}
+
+// randomSecret returns a fresh key for signing cookies and links.
+func randomSecret() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
 }
@@ -0,0 +1,60 @@
+package db
+
+import "github.com/example/filestoragebot/models"
+
+// AddAlias makes file fileID reachable under s as well.
+func (db *DB) AddAlias(fileID int64, s string) (*models.Alias, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var n int
+	if err := tx.QueryRow(slugUses, s, s, s).Scan(&n); err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		return nil, ErrSlugTaken
+	}
+	res, err := tx.Exec("INSERT INTO aliases(file_id, slug) VALUES(?,?)", fileID, s)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &models.Alias{ID: id, FileID: fileID, Slug: s}, nil
+}
+
+// LoadAliases fills f.Aliases, oldest first.
+func (db *DB) LoadAliases(f *models.File) error {
+	rows, err := db.Query("SELECT id, file_id, slug, created_at FROM aliases WHERE file_id=? ORDER BY id", f.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	f.Aliases = nil
+	for rows.Next() {
+		var a models.Alias
+		if err := rows.Scan(&a.ID, &a.FileID, &a.Slug, &a.CreatedAt); err != nil {
+			return err
+		}
+		f.Aliases = append(f.Aliases, a)
+	}
+	return rows.Err()
+}
+
+// GetFileByAlias returns the file served under alias s.
+func (db *DB) GetFileByAlias(s string) (*models.File, error) {
+	return scanFile(db.QueryRow("SELECT "+fileColumns+" FROM files WHERE id=(SELECT file_id FROM aliases WHERE slug=?)", s))
+}
+
+// RemoveAlias deletes an alias of file fileID.
+func (db *DB) RemoveAlias(fileID, id int64) error {
+	_, err := db.Exec("DELETE FROM aliases WHERE file_id=? AND id=?", fileID, id)
+	return err
+}
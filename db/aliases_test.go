@@ -0,0 +1,53 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/example/filestoragebot/models"
+)
+
+func TestAliases(t *testing.T) {
+	database, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	f := &models.File{UserID: 1, StorageName: "a", Slug: "price-2026"}
+	if err := database.AddFile(f); err != nil {
+		t.Fatal(err)
+	}
+	a, err := database.AddAlias(f.ID, "price")
+	if err != nil {
+		t.Fatalf("AddAlias: %v", err)
+	}
+	for _, s := range []string{"price", "price-2026"} {
+		if _, err := database.AddAlias(f.ID, s); err != ErrSlugTaken {
+			t.Errorf("alias %q: got %v, want ErrSlugTaken", s, err)
+		}
+	}
+	if got, err := database.GetFileByAlias("price"); err != nil || got.ID != f.ID {
+		t.Fatalf("GetFileByAlias: %v %v", got, err)
+	}
+	if err := database.ChangeSlug(f.ID, "price"); err != ErrSlugTaken {
+		t.Fatalf("link moved onto an alias: %v", err)
+	}
+	if err := database.LoadAliases(f); err != nil || len(f.Aliases) != 1 || f.Aliases[0].Slug != "price" {
+		t.Fatalf("LoadAliases: %+v %v", f.Aliases, err)
+	}
+	if err := database.RemoveAlias(f.ID+1, a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if taken, _ := database.SlugTaken("price"); !taken {
+		t.Fatal("alias removed through another file")
+	}
+	if deleted, err := database.DeleteFile(f.ID); err != nil || !deleted {
+		t.Fatalf("DeleteFile: %v %v", deleted, err)
+	}
+	// a second delete, e.g. by the janitor, must not be reported as done
+	if deleted, err := database.DeleteFile(f.ID); err != nil || deleted {
+		t.Fatalf("second DeleteFile: %v %v", deleted, err)
+	}
+	if taken, _ := database.SlugTaken("price"); taken {
+		t.Fatal("alias kept after the file was deleted")
+	}
+}
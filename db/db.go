@@ -6,6 +6,7 @@ import (
 	_ "modernc.org/sqlite"
 
 	"github.com/example/filestoragebot/models"
+	"github.com/example/filestoragebot/money"
 )
 
 type DB struct {
@@ -13,7 +14,9 @@ type DB struct {
 }
 
 func New(path string) (*DB, error) {
-	database, err := sql.Open("sqlite", path)
+	// wait for locks instead of failing and take the write lock at BEGIN so
+	// concurrent transactions serialize cleanly
+	database, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_txlock=immediate")
 	if err != nil {
 		return nil, err
 	}
@@ -28,7 +31,7 @@ func migrate(db *sql.DB) error {
 		`CREATE TABLE IF NOT EXISTS users(
                         id INTEGER PRIMARY KEY,
                         telegram_id INTEGER UNIQUE,
-                        balance REAL DEFAULT 0
+                        balance INTEGER DEFAULT 0 CHECK(balance >= 0)
                 );`,
 		`CREATE TABLE IF NOT EXISTS files(
                         id INTEGER PRIMARY KEY,
@@ -36,16 +39,67 @@ func migrate(db *sql.DB) error {
                         local_name TEXT,
                         storage_name TEXT,
                         link TEXT UNIQUE,
+                        slug TEXT,
                         notify INTEGER DEFAULT 0,
                         size INTEGER,
-                        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+                        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                        expires_at INTEGER DEFAULT 0,
+                        max_downloads INTEGER DEFAULT 0,
+                        downloads INTEGER DEFAULT 0,
+                        password_hash TEXT DEFAULT '',
+                        one_time INTEGER DEFAULT 0,
+                        consumed INTEGER DEFAULT 0,
+                        signed_only INTEGER DEFAULT 0,
+                        landing INTEGER DEFAULT 0,
+                        description TEXT DEFAULT '',
+                        file_name TEXT DEFAULT '',
+                        blob TEXT DEFAULT '',
+                        dead_since INTEGER DEFAULT 0
                 );`,
 		`CREATE TABLE IF NOT EXISTS payments(
                         id INTEGER PRIMARY KEY,
                         user_id INTEGER,
-                        amount REAL,
+                        amount INTEGER,
+                        provider TEXT,
+                        invoice_id TEXT,
+                        status TEXT DEFAULT 'paid',
+                        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                        updated_at TIMESTAMP,
+                        paid_at TIMESTAMP
+                );`,
+		`CREATE TABLE IF NOT EXISTS reservations(
+                        id INTEGER PRIMARY KEY,
+                        user_id INTEGER,
+                        amount INTEGER,
+                        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+                );`,
+		`CREATE TABLE IF NOT EXISTS link_history(
+                        id INTEGER PRIMARY KEY,
+                        slug TEXT UNIQUE,
+                        file_id INTEGER,
+                        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+                );`,
+		`CREATE TABLE IF NOT EXISTS aliases(
+                        id INTEGER PRIMARY KEY,
+                        file_id INTEGER,
+                        slug TEXT UNIQUE,
+                        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+                );`,
+		`CREATE TABLE IF NOT EXISTS file_versions(
+                        id INTEGER PRIMARY KEY,
+                        file_id INTEGER,
+                        blob TEXT,
+                        file_name TEXT,
+                        size INTEGER,
                         created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
                 );`,
+		`CREATE TABLE IF NOT EXISTS state(
+                        kind TEXT,
+                        key TEXT,
+                        value TEXT,
+                        expires_at INTEGER,
+                        PRIMARY KEY(kind, key)
+                );`,
 	}
 	for _, q := range queries {
 		if _, err := db.Exec(q); err != nil {
@@ -54,7 +108,39 @@ func migrate(db *sql.DB) error {
 	}
 	// ensure created_at column exists in older databases
 	db.Exec("ALTER TABLE files ADD COLUMN created_at TIMESTAMP")
-	return nil
+	// link lifetime and download limit
+	db.Exec("ALTER TABLE files ADD COLUMN expires_at INTEGER DEFAULT 0")
+	db.Exec("ALTER TABLE files ADD COLUMN max_downloads INTEGER DEFAULT 0")
+	db.Exec("ALTER TABLE files ADD COLUMN downloads INTEGER DEFAULT 0")
+	db.Exec("ALTER TABLE files ADD COLUMN password_hash TEXT DEFAULT ''")
+	db.Exec("ALTER TABLE files ADD COLUMN one_time INTEGER DEFAULT 0")
+	db.Exec("ALTER TABLE files ADD COLUMN consumed INTEGER DEFAULT 0")
+	db.Exec("ALTER TABLE files ADD COLUMN signed_only INTEGER DEFAULT 0")
+	db.Exec("ALTER TABLE files ADD COLUMN landing INTEGER DEFAULT 0")
+	db.Exec("ALTER TABLE files ADD COLUMN description TEXT DEFAULT ''")
+	// original Telegram file name, used for Content-Disposition
+	db.Exec("ALTER TABLE files ADD COLUMN file_name TEXT DEFAULT ''")
+	// link held the full URL before slugs were stored on their own; see
+	// MigrateLinks
+	db.Exec("ALTER TABLE files ADD COLUMN slug TEXT")
+	// storage key of replaced contents; empty means storage_name
+	db.Exec("ALTER TABLE files ADD COLUMN blob TEXT DEFAULT ''")
+	// when the janitor first found the link dead
+	db.Exec("ALTER TABLE files ADD COLUMN dead_since INTEGER DEFAULT 0")
+	if _, err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS files_slug ON files(slug)"); err != nil {
+		return err
+	}
+	// payments ledger columns; rows written before them were already credited
+	db.Exec("ALTER TABLE payments ADD COLUMN provider TEXT")
+	db.Exec("ALTER TABLE payments ADD COLUMN invoice_id TEXT")
+	db.Exec("ALTER TABLE payments ADD COLUMN status TEXT DEFAULT 'paid'")
+	db.Exec("ALTER TABLE payments ADD COLUMN updated_at TIMESTAMP")
+	db.Exec("ALTER TABLE payments ADD COLUMN paid_at TIMESTAMP")
+	if err := upgrade(db); err != nil {
+		return err
+	}
+	_, err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS payments_invoice ON payments(provider, invoice_id)")
+	return err
 }
 
 // GetOrCreateUser returns a user by telegram ID, creating a record if necessary.
@@ -75,25 +161,25 @@ func (db *DB) GetOrCreateUser(tgID int64) (int64, error) {
 	return id, err
 }
 
-func (db *DB) AdjustBalance(userID int64, delta float64) error {
+func (db *DB) AdjustBalance(userID int64, delta money.Amount) error {
 	_, err := db.Exec("UPDATE users SET balance = balance + ? WHERE id=?", delta, userID)
 	return err
 }
 
-func (db *DB) SetBalance(userID int64, value float64) error {
+func (db *DB) SetBalance(userID int64, value money.Amount) error {
 	_, err := db.Exec("UPDATE users SET balance = ? WHERE id=?", value, userID)
 	return err
 }
 
-func (db *DB) GetBalance(userID int64) (float64, error) {
-	var b float64
+func (db *DB) GetBalance(userID int64) (money.Amount, error) {
+	var b money.Amount
 	err := db.QueryRow("SELECT balance FROM users WHERE id=?", userID).Scan(&b)
 	return b, err
 }
 
 func (db *DB) AddFile(f *models.File) error {
-	res, err := db.Exec(`INSERT INTO files(user_id, local_name, storage_name, link, notify, size)
-                VALUES(?,?,?,?,?,?)`, f.UserID, f.LocalName, f.StorageName, f.Link, boolToInt(f.Notify), f.Size)
+	res, err := db.Exec(`INSERT INTO files(user_id, local_name, storage_name, slug, notify, size, expires_at, max_downloads, file_name)
+                VALUES(?,?,?,?,?,?,?,?,?)`, f.UserID, f.LocalName, f.StorageName, f.Slug, boolToInt(f.Notify), f.Size, f.ExpiresAt, f.MaxDownloads, f.FileName)
 	if err != nil {
 		return err
 	}
@@ -113,66 +199,44 @@ func boolToInt(b bool) int {
 }
 
 func (db *DB) ListFiles(userID int64) ([]models.File, error) {
-	rows, err := db.Query("SELECT id, user_id, local_name, storage_name, link, notify, size, created_at FROM files WHERE user_id=?", userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var files []models.File
-	for rows.Next() {
-		var f models.File
-		var notify int
-		if err := rows.Scan(&f.ID, &f.UserID, &f.LocalName, &f.StorageName, &f.Link, &notify, &f.Size, &f.CreatedAt); err != nil {
-			return nil, err
-		}
-		f.Notify = notify == 1
-		files = append(files, f)
-	}
-	return files, rows.Err()
+	return db.queryFiles("SELECT "+fileColumns+" FROM files WHERE user_id=?", userID)
 }
 
 func (db *DB) GetFileByStorageName(name string) (*models.File, error) {
-	row := db.QueryRow("SELECT id, user_id, local_name, storage_name, link, notify, size, created_at FROM files WHERE storage_name=?", name)
-	var f models.File
-	var notify int
-	if err := row.Scan(&f.ID, &f.UserID, &f.LocalName, &f.StorageName, &f.Link, &notify, &f.Size, &f.CreatedAt); err != nil {
-		return nil, err
-	}
-	f.Notify = notify == 1
-	return &f, nil
+	return scanFile(db.QueryRow("SELECT "+fileColumns+" FROM files WHERE storage_name=?", name))
 }
 
 func (db *DB) GetFileByLocalName(userID int64, local string) (*models.File, error) {
-	row := db.QueryRow("SELECT id, user_id, local_name, storage_name, link, notify, size, created_at FROM files WHERE user_id=? AND local_name=?", userID, local)
-	var f models.File
-	var notify int
-	if err := row.Scan(&f.ID, &f.UserID, &f.LocalName, &f.StorageName, &f.Link, &notify, &f.Size, &f.CreatedAt); err != nil {
-		return nil, err
-	}
-	f.Notify = notify == 1
-	return &f, nil
+	return scanFile(db.QueryRow("SELECT "+fileColumns+" FROM files WHERE user_id=? AND local_name=?", userID, local))
 }
 
-// GetFileByLink returns a file record by its full link.
-func (db *DB) GetFileByLink(link string) (*models.File, error) {
-	row := db.QueryRow("SELECT id, user_id, local_name, storage_name, link, notify, size, created_at FROM files WHERE link=?", link)
-	var f models.File
-	var notify int
-	if err := row.Scan(&f.ID, &f.UserID, &f.LocalName, &f.StorageName, &f.Link, &notify, &f.Size, &f.CreatedAt); err != nil {
-		return nil, err
-	}
-	f.Notify = notify == 1
-	return &f, nil
-}
-
-func (db *DB) DeleteFile(id int64) error {
-	_, err := db.Exec("DELETE FROM files WHERE id=?", id)
-	return err
+// GetFileBySlug returns a file record by the link part after the domain.
+func (db *DB) GetFileBySlug(s string) (*models.File, error) {
+	return scanFile(db.QueryRow("SELECT "+fileColumns+" FROM files WHERE slug=?", s))
 }
 
-func (db *DB) AddPayment(userID int64, amount float64) error {
-	_, err := db.Exec(`INSERT INTO payments(user_id, amount) VALUES(?,?)`, userID, amount)
-	return err
+// DeleteFile removes file id with its links and versions. It reports false
+// if the file was already deleted by someone else, so a refund is only given
+// once.
+func (db *DB) DeleteFile(id int64) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec("DELETE FROM files WHERE id=?", id)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	for _, table := range []string{"link_history", "aliases", "file_versions"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE file_id=?", id); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
 }
 
 func (db *DB) GetTelegramID(userID int64) (int64, error) {
@@ -182,20 +246,5 @@ func (db *DB) GetTelegramID(userID int64) (int64, error) {
 }
 
 func (db *DB) ListAllFiles() ([]models.File, error) {
-	rows, err := db.Query("SELECT id, user_id, local_name, storage_name, link, notify, size, created_at FROM files")
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var files []models.File
-	for rows.Next() {
-		var f models.File
-		var notify int
-		if err := rows.Scan(&f.ID, &f.UserID, &f.LocalName, &f.StorageName, &f.Link, &notify, &f.Size, &f.CreatedAt); err != nil {
-			return nil, err
-		}
-		f.Notify = notify == 1
-		files = append(files, f)
-	}
-	return files, rows.Err()
+	return db.queryFiles("SELECT " + fileColumns + " FROM files")
 }
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"time"
+
+	"github.com/example/filestoragebot/models"
+)
+
+const fileColumns = "id, user_id, local_name, storage_name, slug, notify, size, created_at, expires_at, max_downloads, downloads, COALESCE(password_hash,''), one_time, consumed, signed_only, landing, COALESCE(description,''), COALESCE(file_name,''), COALESCE(NULLIF(blob,''), storage_name)"
+
+func scanFile(row interface{ Scan(...interface{}) error }) (*models.File, error) {
+	var f models.File
+	var notify, oneTime, consumed, signedOnly, landing int
+	if err := row.Scan(&f.ID, &f.UserID, &f.LocalName, &f.StorageName, &f.Slug, &notify, &f.Size, &f.CreatedAt,
+		&f.ExpiresAt, &f.MaxDownloads, &f.Downloads, &f.PasswordHash, &oneTime, &consumed, &signedOnly, &landing, &f.Description, &f.FileName, &f.Blob); err != nil {
+		return nil, err
+	}
+	f.Notify = notify == 1
+	f.OneTime = oneTime == 1
+	f.Consumed = consumed == 1
+	f.SignedOnly = signedOnly == 1
+	f.Landing = landing == 1
+	return &f, nil
+}
+
+func (db *DB) queryFiles(query string, args ...interface{}) ([]models.File, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var files []models.File
+	for rows.Next() {
+		f, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, *f)
+	}
+	return files, rows.Err()
+}
+
+// SetFileLimits changes when the link of a file expires (unix time, 0 for
+// never) and how many downloads it allows (0 for unlimited).
+func (db *DB) SetFileLimits(id, expiresAt int64, maxDownloads int) error {
+	_, err := db.Exec("UPDATE files SET expires_at=?, max_downloads=?, dead_since=0 WHERE id=?", expiresAt, maxDownloads, id)
+	return err
+}
+
+// SetFilePassword stores the bcrypt hash protecting a file; an empty hash
+// removes the password.
+func (db *DB) SetFilePassword(id int64, hash string) error {
+	_, err := db.Exec("UPDATE files SET password_hash=? WHERE id=?", hash, id)
+	return err
+}
+
+// SetOneTime switches the one-time mode of a file. Switching it re-arms a
+// consumed link.
+func (db *DB) SetOneTime(id int64, on bool) error {
+	_, err := db.Exec("UPDATE files SET one_time=?, consumed=0 WHERE id=?", boolToInt(on), id)
+	return err
+}
+
+// SetSignedOnly switches whether a file may be downloaded only through
+// signed URLs.
+func (db *DB) SetSignedOnly(id int64, on bool) error {
+	_, err := db.Exec("UPDATE files SET signed_only=? WHERE id=?", boolToInt(on), id)
+	return err
+}
+
+// SetLanding switches the landing page of a file.
+func (db *DB) SetLanding(id int64, on bool) error {
+	_, err := db.Exec("UPDATE files SET landing=? WHERE id=?", boolToInt(on), id)
+	return err
+}
+
+// SetDescription changes the text shown on the landing page of a file.
+func (db *DB) SetDescription(id int64, description string) error {
+	_, err := db.Exec("UPDATE files SET description=? WHERE id=?", description, id)
+	return err
+}
+
+// ClaimOneTime marks a one-time link as consumed. Only one caller can
+// succeed; it must call ReleaseOneTime if the download does not complete.
+func (db *DB) ClaimOneTime(id int64) (bool, error) {
+	res, err := db.Exec("UPDATE files SET consumed=1 WHERE id=? AND one_time=1 AND consumed=0", id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ReleaseOneTime re-arms a one-time link after an interrupted download.
+func (db *DB) ReleaseOneTime(id int64) error {
+	_, err := db.Exec("UPDATE files SET consumed=0 WHERE id=? AND one_time=1", id)
+	return err
+}
+
+// CountDownload records a download of a file if its link is still live. It
+// reports false once the link has expired or used up its downloads.
+func (db *DB) CountDownload(id int64) (bool, error) {
+	res, err := db.Exec(`UPDATE files SET downloads = downloads + 1 WHERE id=?
+                AND (expires_at=0 OR expires_at>?) AND (max_downloads=0 OR downloads<max_downloads)`, id, time.Now().Unix())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// deadFile matches files whose links have expired or used up their
+// downloads; it takes the current unix time.
+const deadFile = "((expires_at>0 AND expires_at<=?) OR (max_downloads>0 AND downloads>=max_downloads))"
+
+// ListDeadFiles returns files whose links have been dead for at least grace.
+// Files are first marked when found dead, so a download that was let through
+// just before the link died has grace to finish before the file is removed.
+func (db *DB) ListDeadFiles(grace time.Duration) ([]models.File, error) {
+	now := time.Now().Unix()
+	if _, err := db.Exec("UPDATE files SET dead_since=? WHERE dead_since=0 AND "+deadFile, now, now); err != nil {
+		return nil, err
+	}
+	return db.queryFiles(`SELECT `+fileColumns+` FROM files
+                WHERE dead_since>0 AND dead_since<=? AND `+deadFile, now-int64(grace/time.Second), now)
+}
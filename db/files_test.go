@@ -0,0 +1,109 @@
+package db
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/example/filestoragebot/models"
+)
+
+func TestDownloadLimits(t *testing.T) {
+	database, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	limited := &models.File{UserID: 1, StorageName: "a", Slug: "a", MaxDownloads: 2}
+	expired := &models.File{UserID: 1, StorageName: "b", Slug: "b", ExpiresAt: time.Now().Add(-time.Minute).Unix()}
+	forever := &models.File{UserID: 1, StorageName: "c", Slug: "c"}
+	for _, f := range []*models.File{limited, expired, forever} {
+		if err := database.AddFile(f); err != nil {
+			t.Fatalf("AddFile: %v", err)
+		}
+	}
+	for i, want := range []bool{true, true, false} {
+		if ok, err := database.CountDownload(limited.ID); err != nil || ok != want {
+			t.Fatalf("download %d: %v, %v", i, ok, err)
+		}
+	}
+	if ok, _ := database.CountDownload(expired.ID); ok {
+		t.Fatalf("expired link counted")
+	}
+	if ok, _ := database.CountDownload(forever.ID); !ok {
+		t.Fatalf("unlimited link refused")
+	}
+	// the last download may still be streaming, so dead files are kept
+	// for the grace period
+	if dead, err := database.ListDeadFiles(time.Hour); err != nil || len(dead) != 0 {
+		t.Fatalf("dead files within grace: %+v %v", dead, err)
+	}
+	database.Exec("UPDATE files SET dead_since=dead_since-3600")
+	dead, err := database.ListDeadFiles(time.Hour)
+	if err != nil {
+		t.Fatalf("ListDeadFiles: %v", err)
+	}
+	if len(dead) != 2 || dead[0].ID != limited.ID || dead[0].Downloads != 2 || dead[1].ID != expired.ID {
+		t.Fatalf("dead files %+v", dead)
+	}
+	// raising the limit revives the file and restarts the grace period
+	if err := database.SetFileLimits(limited.ID, 0, 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.SetFileLimits(limited.ID, 0, 2); err != nil {
+		t.Fatal(err)
+	}
+	if dead, _ := database.ListDeadFiles(time.Hour); len(dead) != 1 || dead[0].ID != expired.ID {
+		t.Fatalf("dead files after a limit change %+v", dead)
+	}
+}
+
+func TestClaimOneTimeOnce(t *testing.T) {
+	database, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	f := &models.File{UserID: 1, StorageName: "a", Slug: "a"}
+	if err := database.AddFile(f); err != nil {
+		t.Fatalf("AddFile: %v", err)
+	}
+	if ok, _ := database.ClaimOneTime(f.ID); ok {
+		t.Fatalf("claimed a regular link")
+	}
+	if err := database.SetOneTime(f.ID, true); err != nil {
+		t.Fatalf("SetOneTime: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	claims := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := database.ClaimOneTime(f.ID)
+			if err != nil {
+				t.Errorf("ClaimOneTime: %v", err)
+				return
+			}
+			if ok {
+				mu.Lock()
+				claims++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if claims != 1 {
+		t.Fatalf("claimed %d times", claims)
+	}
+	if err := database.ReleaseOneTime(f.ID); err != nil {
+		t.Fatalf("ReleaseOneTime: %v", err)
+	}
+	if ok, _ := database.ClaimOneTime(f.ID); !ok {
+		t.Fatalf("released link cannot be claimed")
+	}
+	if got, _ := database.GetFileBySlug("a"); !got.Consumed {
+		t.Fatalf("claimed link not consumed")
+	}
+}
@@ -0,0 +1,158 @@
+package db
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/example/filestoragebot/models"
+)
+
+// MigrateLinks fills the slug of files created when the full URL was stored
+// in link. Links under domain are converted first so they keep their slug;
+// links left from an older domain get a numeric suffix if their slug is
+// already taken. It returns the number of converted files.
+func (db *DB) MigrateLinks(domain string) (int, error) {
+	prefix := strings.TrimRight(domain, "/") + "/"
+	rows, err := db.Query(`SELECT id, link FROM files WHERE slug IS NULL AND link IS NOT NULL
+                ORDER BY substr(link, 1, ?) <> ?, id`, len(prefix), prefix)
+	if err != nil {
+		return 0, err
+	}
+	type legacy struct {
+		id   int64
+		link string
+	}
+	var todo []legacy
+	for rows.Next() {
+		var l legacy
+		if err := rows.Scan(&l.id, &l.link); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		todo = append(todo, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, l := range todo {
+		s := legacySlug(l.link)
+		if s == "" {
+			s = "file"
+		}
+		taken, err := db.SlugTaken(s)
+		if err != nil {
+			return 0, err
+		}
+		if taken {
+			s += "-" + strconv.FormatInt(l.id, 10)
+		}
+		if _, err := db.Exec("UPDATE files SET slug=? WHERE id=?", s, l.id); err != nil {
+			return 0, err
+		}
+	}
+	return len(todo), nil
+}
+
+// legacySlug returns the last path element of a stored URL, which is the part
+// the server used to look files up by.
+func legacySlug(link string) string {
+	p := link
+	if u, err := url.Parse(link); err == nil {
+		p = u.Path
+	}
+	p = strings.TrimRight(p, "/")
+	return p[strings.LastIndex(p, "/")+1:]
+}
+
+// ErrSlugTaken is returned when a slug is used by another file, currently or
+// as an old link.
+var ErrSlugTaken = errors.New("slug taken")
+
+// slugUses counts the links, old links and aliases using s in any case:
+// migrated links keep their case, and the server falls back to the folded
+// form.
+const slugUses = `SELECT (SELECT COUNT(*) FROM files WHERE lower(slug)=lower(?))
+                + (SELECT COUNT(*) FROM link_history WHERE lower(slug)=lower(?))
+                + (SELECT COUNT(*) FROM aliases WHERE lower(slug)=lower(?))`
+
+// SlugTaken reports whether s is published by some file, as a link or an
+// alias, or still redirects to one.
+func (db *DB) SlugTaken(s string) (bool, error) {
+	var n int
+	err := db.QueryRow(slugUses, s, s, s).Scan(&n)
+	return n > 0, err
+}
+
+// ChangeSlug publishes file id under s and keeps its previous slug as an old
+// link. An old link of the same file may be taken back.
+func (db *DB) ChangeSlug(id int64, s string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var n int
+	if err := tx.QueryRow(`SELECT (SELECT COUNT(*) FROM files WHERE lower(slug)=lower(?) AND id<>?)
+                + (SELECT COUNT(*) FROM link_history WHERE lower(slug)=lower(?) AND file_id<>?)
+                + (SELECT COUNT(*) FROM aliases WHERE lower(slug)=lower(?))`, s, id, s, id, s).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrSlugTaken
+	}
+	var old string
+	if err := tx.QueryRow("SELECT slug FROM files WHERE id=?", id).Scan(&old); err != nil {
+		return err
+	}
+	if old == s {
+		return nil
+	}
+	if _, err := tx.Exec("UPDATE files SET slug=? WHERE id=?", s, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM link_history WHERE lower(slug)=lower(?)", s); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO link_history(slug, file_id) VALUES(?,?)", old, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetFileByOldSlug returns the file that used to be published under s.
+func (db *DB) GetFileByOldSlug(s string) (*models.File, error) {
+	return scanFile(db.QueryRow("SELECT "+fileColumns+" FROM files WHERE id=(SELECT file_id FROM link_history WHERE slug=?)", s))
+}
+
+// ListOldLinks returns the old links of a file, oldest first.
+func (db *DB) ListOldLinks(fileID int64) ([]models.OldLink, error) {
+	rows, err := db.Query("SELECT id, file_id, slug, created_at FROM link_history WHERE file_id=? ORDER BY id", fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []models.OldLink
+	for rows.Next() {
+		var l models.OldLink
+		if err := rows.Scan(&l.ID, &l.FileID, &l.Slug, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, l)
+	}
+	return res, rows.Err()
+}
+
+// RevokeOldLink stops an old link of a file from redirecting; id 0 revokes
+// all of them.
+func (db *DB) RevokeOldLink(fileID, id int64) error {
+	if id == 0 {
+		_, err := db.Exec("DELETE FROM link_history WHERE file_id=?", fileID)
+		return err
+	}
+	_, err := db.Exec("DELETE FROM link_history WHERE file_id=? AND id=?", fileID, id)
+	return err
+}
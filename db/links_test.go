@@ -0,0 +1,95 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/example/filestoragebot/models"
+)
+
+func TestMigrateLinks(t *testing.T) {
+	database, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	legacy := []string{
+		"http://old.example.com/report", // taken by the current domain below
+		"https://files.example.com/report",
+		"https://files.example.com/sub/photo",
+		"https://files.example.com/",
+		"https://files.example.com/Photo", // differs from photo only in case
+	}
+	for i, link := range legacy {
+		if _, err := database.Exec("INSERT INTO files(id, user_id, storage_name, link) VALUES(?,1,?,?)", i+1, link, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, err := database.MigrateLinks("https://files.example.com/")
+	if err != nil || n != len(legacy) {
+		t.Fatalf("MigrateLinks: %d %v", n, err)
+	}
+	want := map[int64]string{1: "report-1", 2: "report", 3: "photo", 4: "file", 5: "Photo-5"}
+	for id, s := range want {
+		var got string
+		database.QueryRow("SELECT slug FROM files WHERE id=?", id).Scan(&got)
+		if got != s {
+			t.Errorf("file %d: got %q, want %q", id, got, s)
+		}
+	}
+	if n, _ := database.MigrateLinks("https://files.example.com"); n != 0 {
+		t.Errorf("second run converted %d files", n)
+	}
+	// new slugs are lowercase and must not take over a legacy mixed-case link
+	if _, err := database.Exec("UPDATE files SET slug='Report' WHERE id=2"); err != nil {
+		t.Fatal(err)
+	}
+	if taken, _ := database.SlugTaken("report"); !taken {
+		t.Error("report not taken by Report")
+	}
+	if err := database.ChangeSlug(3, "report"); err != ErrSlugTaken {
+		t.Errorf("ChangeSlug to report: %v", err)
+	}
+	if _, err := database.AddAlias(3, "report"); err != ErrSlugTaken {
+		t.Errorf("AddAlias report: %v", err)
+	}
+}
+
+func TestChangeSlug(t *testing.T) {
+	database, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	a := &models.File{UserID: 1, StorageName: "a", Slug: "first"}
+	b := &models.File{UserID: 1, StorageName: "b", Slug: "other"}
+	for _, f := range []*models.File{a, b} {
+		if err := database.AddFile(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := database.ChangeSlug(a.ID, "second"); err != nil {
+		t.Fatalf("ChangeSlug: %v", err)
+	}
+	if f, err := database.GetFileByOldSlug("first"); err != nil || f.ID != a.ID || f.Slug != "second" {
+		t.Fatalf("old slug: %v %v", f, err)
+	}
+	if err := database.ChangeSlug(b.ID, "first"); err != ErrSlugTaken {
+		t.Fatalf("old link of another file taken over: %v", err)
+	}
+	if err := database.ChangeSlug(b.ID, "second"); err != ErrSlugTaken {
+		t.Fatalf("current link of another file taken over: %v", err)
+	}
+	// taking back its own old link drops it from the history
+	if err := database.ChangeSlug(a.ID, "first"); err != nil {
+		t.Fatalf("ChangeSlug back: %v", err)
+	}
+	old, _ := database.ListOldLinks(a.ID)
+	if len(old) != 1 || old[0].Slug != "second" {
+		t.Fatalf("history: %+v", old)
+	}
+	if err := database.RevokeOldLink(a.ID, old[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if taken, _ := database.SlugTaken("second"); taken {
+		t.Fatal("revoked link still taken")
+	}
+}
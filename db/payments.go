@@ -0,0 +1,118 @@
+package db
+
+import (
+	"github.com/example/filestoragebot/models"
+	"github.com/example/filestoragebot/money"
+)
+
+const paymentColumns = "id, user_id, amount, COALESCE(provider,''), COALESCE(invoice_id,''), status, created_at, COALESCE(updated_at,''), COALESCE(paid_at,'')"
+
+func scanPayment(row interface{ Scan(...interface{}) error }) (*models.Payment, error) {
+	var p models.Payment
+	if err := row.Scan(&p.ID, &p.UserID, &p.Amount, &p.Provider, &p.InvoiceID, &p.Status, &p.CreatedAt, &p.UpdatedAt, &p.PaidAt); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// AddInvoice records a freshly issued provider invoice as a pending payment.
+func (db *DB) AddInvoice(userID int64, amount money.Amount, provider, invoiceID string) (*models.Payment, error) {
+	res, err := db.Exec(`INSERT INTO payments(user_id, amount, provider, invoice_id, status, updated_at)
+                VALUES(?,?,?,?,?,CURRENT_TIMESTAMP)`, userID, amount, provider, invoiceID, models.PaymentPending)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return db.GetPayment(id)
+}
+
+func (db *DB) GetPayment(id int64) (*models.Payment, error) {
+	return scanPayment(db.QueryRow("SELECT "+paymentColumns+" FROM payments WHERE id=?", id))
+}
+
+// GetPaymentByInvoice looks a payment up by the provider's invoice id.
+func (db *DB) GetPaymentByInvoice(provider, invoiceID string) (*models.Payment, error) {
+	return scanPayment(db.QueryRow("SELECT "+paymentColumns+" FROM payments WHERE provider=? AND invoice_id=?", provider, invoiceID))
+}
+
+// ListPendingPayments returns invoices that have not been paid yet.
+func (db *DB) ListPendingPayments() ([]models.Payment, error) {
+	rows, err := db.Query("SELECT "+paymentColumns+" FROM payments WHERE status=? ORDER BY id", models.PaymentPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []models.Payment
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *p)
+	}
+	return res, rows.Err()
+}
+
+// ExpirePayment closes a pending invoice without crediting it. It reports
+// false if the invoice was no longer pending.
+func (db *DB) ExpirePayment(id int64) (bool, error) {
+	res, err := db.Exec("UPDATE payments SET status=?, updated_at=CURRENT_TIMESTAMP WHERE id=? AND status=?",
+		models.PaymentExpired, id, models.PaymentPending)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// CreditInvoice marks a pending invoice as paid and adds its amount to the
+// owner's balance in a single transaction. The returned flag is false when
+// the invoice had already been credited (or expired), so every invoice is
+// credited at most once no matter how many times this is called.
+func (db *DB) CreditInvoice(provider, invoiceID string) (*models.Payment, bool, error) {
+	return db.credit(provider, invoiceID, false)
+}
+
+// CreditCapturedInvoice is CreditInvoice for a payment the provider has
+// already captured, such as Telegram Stars: an invoice that expired here in
+// the meantime is credited as well.
+func (db *DB) CreditCapturedInvoice(provider, invoiceID string) (*models.Payment, bool, error) {
+	return db.credit(provider, invoiceID, true)
+}
+
+// credit marks a pending invoice, or with expired also an expired one, as
+// paid and adds its amount to the balance.
+func (db *DB) credit(provider, invoiceID string, expired bool) (*models.Payment, bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`UPDATE payments SET status=?, paid_at=CURRENT_TIMESTAMP, updated_at=CURRENT_TIMESTAMP
+                WHERE provider=? AND invoice_id=? AND (status=? OR (? AND status=?))`,
+		models.PaymentPaid, provider, invoiceID, models.PaymentPending, boolToInt(expired), models.PaymentExpired)
+	if err != nil {
+		return nil, false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, false, err
+	}
+	p, err := scanPayment(tx.QueryRow("SELECT "+paymentColumns+" FROM payments WHERE provider=? AND invoice_id=?", provider, invoiceID))
+	if err != nil {
+		return nil, false, err
+	}
+	if n == 0 {
+		return p, false, nil
+	}
+	if _, err := tx.Exec("UPDATE users SET balance = balance + ? WHERE id=?", p.Amount, p.UserID); err != nil {
+		return nil, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+	return p, true, nil
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/example/filestoragebot/money"
+)
+
+func TestCreditInvoiceOnce(t *testing.T) {
+	database, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	userID, err := database.GetOrCreateUser(1)
+	if err != nil {
+		t.Fatalf("GetOrCreateUser: %v", err)
+	}
+	if _, err := database.AddInvoice(userID, 5*money.USDT, "crypto", "42"); err != nil {
+		t.Fatalf("AddInvoice: %v", err)
+	}
+	if _, err := database.AddInvoice(userID, 5*money.USDT, "crypto", "42"); err == nil {
+		t.Fatalf("duplicate invoice accepted")
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	credits := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, ok, err := database.CreditInvoice("crypto", "42")
+			if err != nil {
+				t.Errorf("CreditInvoice: %v", err)
+				return
+			}
+			if ok {
+				mu.Lock()
+				credits++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if credits != 1 {
+		t.Fatalf("credited %d times", credits)
+	}
+	bal, err := database.GetBalance(userID)
+	if err != nil {
+		t.Fatalf("GetBalance: %v", err)
+	}
+	if bal != 5*money.USDT {
+		t.Fatalf("balance %v, want 5", bal)
+	}
+}
+
+func TestCreditCapturedExpiredInvoice(t *testing.T) {
+	database, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	userID, _ := database.GetOrCreateUser(1)
+	p, err := database.AddInvoice(userID, 2*money.USDT, "stars", "abc")
+	if err != nil {
+		t.Fatalf("AddInvoice: %v", err)
+	}
+	if ok, err := database.ExpirePayment(p.ID); err != nil || !ok {
+		t.Fatalf("ExpirePayment: %v %v", ok, err)
+	}
+	if _, ok, _ := database.CreditInvoice("stars", "abc"); ok {
+		t.Fatal("expired invoice credited by CreditInvoice")
+	}
+	for i := 0; i < 2; i++ {
+		_, ok, err := database.CreditCapturedInvoice("stars", "abc")
+		if err != nil || ok != (i == 0) {
+			t.Fatalf("CreditCapturedInvoice #%d: %v %v", i+1, ok, err)
+		}
+	}
+	if bal, _ := database.GetBalance(userID); bal != 2*money.USDT {
+		t.Fatalf("balance %v, want 2", bal)
+	}
+}
@@ -0,0 +1,136 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/example/filestoragebot/models"
+	"github.com/example/filestoragebot/money"
+)
+
+// ErrInsufficientFunds is returned when a charge would make the balance
+// negative.
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+// Reserve holds amount on the user's balance and returns the reservation ID.
+// The money leaves the balance immediately so concurrent uploads cannot
+// spend it twice.
+func (db *DB) Reserve(userID int64, amount money.Amount) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec("UPDATE users SET balance = balance - ? WHERE id=? AND balance >= ?", amount, userID, amount)
+	if err != nil {
+		return 0, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return 0, err
+	} else if n == 0 {
+		return 0, ErrInsufficientFunds
+	}
+	res, err = tx.Exec("INSERT INTO reservations(user_id, amount) VALUES(?,?)", userID, amount)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// AddFileReserved inserts f and settles the reservation in one transaction.
+// If the reservation is gone (it was released as stale) the cost is charged
+// again, which fails with ErrInsufficientFunds when the balance is too low.
+func (db *DB) AddFileReserved(f *models.File, reservationID int64, cost money.Amount) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec("DELETE FROM reservations WHERE id=? AND user_id=?", reservationID, f.UserID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		res, err := tx.Exec("UPDATE users SET balance = balance - ? WHERE id=? AND balance >= ?", cost, f.UserID, cost)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrInsufficientFunds
+		}
+	}
+	res, err = tx.Exec(`INSERT INTO files(user_id, local_name, storage_name, slug, notify, size, expires_at, max_downloads, file_name)
+                VALUES(?,?,?,?,?,?,?,?,?)`, f.UserID, f.LocalName, f.StorageName, f.Slug, boolToInt(f.Notify), f.Size, f.ExpiresAt, f.MaxDownloads, f.FileName)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	f.ID = id
+	return nil
+}
+
+// ReleaseReservation returns held money to the balance. Releasing an
+// already settled reservation does nothing.
+func (db *DB) ReleaseReservation(id int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var userID int64
+	var amount money.Amount
+	err = tx.QueryRow("DELETE FROM reservations WHERE id=? RETURNING user_id, amount", id).Scan(&userID, &amount)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE users SET balance = balance + ? WHERE id=?", amount, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReleaseStaleReservations releases holds older than age, left behind by
+// abandoned uploads or restarts, and returns how many were released.
+func (db *DB) ReleaseStaleReservations(age time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-age).UTC().Format("2006-01-02 15:04:05")
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`UPDATE users SET balance = balance +
+                (SELECT SUM(amount) FROM reservations r WHERE r.user_id=users.id AND r.created_at<?)
+                WHERE id IN (SELECT user_id FROM reservations WHERE created_at<?)`, cutoff, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec("DELETE FROM reservations WHERE created_at<?", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
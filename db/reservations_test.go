@@ -0,0 +1,75 @@
+package db
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/example/filestoragebot/models"
+	"github.com/example/filestoragebot/money"
+)
+
+func TestReserveNoOverdraft(t *testing.T) {
+	database, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	userID, err := database.GetOrCreateUser(1)
+	if err != nil {
+		t.Fatalf("GetOrCreateUser: %v", err)
+	}
+	if err := database.SetBalance(userID, 3*money.USDT); err != nil {
+		t.Fatalf("SetBalance: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var held []int64
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id, err := database.Reserve(userID, money.USDT)
+			if err == ErrInsufficientFunds {
+				return
+			}
+			if err != nil {
+				t.Errorf("Reserve: %v", err)
+				return
+			}
+			mu.Lock()
+			held = append(held, id)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if len(held) != 3 {
+		t.Fatalf("%d reservations, want 3", len(held))
+	}
+	if bal, _ := database.GetBalance(userID); bal != 0 {
+		t.Fatalf("balance %v, want 0", bal)
+	}
+
+	f := &models.File{UserID: userID, StorageName: "s", Slug: "l"}
+	if err := database.AddFileReserved(f, held[0], money.USDT); err != nil {
+		t.Fatalf("AddFileReserved: %v", err)
+	}
+	if err := database.ReleaseReservation(held[0]); err != nil {
+		t.Fatalf("ReleaseReservation: %v", err)
+	}
+	if err := database.ReleaseReservation(held[1]); err != nil {
+		t.Fatalf("ReleaseReservation: %v", err)
+	}
+	if bal, _ := database.GetBalance(userID); bal != money.USDT {
+		t.Fatalf("balance %v, want 1", bal)
+	}
+
+	// a released hold is charged again on commit
+	g := &models.File{UserID: userID, StorageName: "s2", Slug: "l2"}
+	if err := database.AddFileReserved(g, held[1], 2*money.USDT); err != ErrInsufficientFunds {
+		t.Fatalf("expected ErrInsufficientFunds, got %v", err)
+	}
+	if err := database.AdjustBalance(userID, -2*money.USDT); err == nil {
+		t.Fatalf("negative balance accepted")
+	}
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// SaveState stores v as JSON under kind/key replacing any previous value.
+// The record is ignored once ttl has passed.
+func (db *DB) SaveState(kind, key string, v interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO state(kind, key, value, expires_at) VALUES(?,?,?,?)
+                ON CONFLICT(kind, key) DO UPDATE SET value=excluded.value, expires_at=excluded.expires_at`,
+		kind, key, string(data), time.Now().Add(ttl).Unix())
+	return err
+}
+
+// LoadState decodes the value stored under kind/key into v. It reports
+// whether a live record was found.
+func (db *DB) LoadState(kind, key string, v interface{}) (bool, error) {
+	var data string
+	err := db.QueryRow("SELECT value FROM state WHERE kind=? AND key=? AND expires_at>?",
+		kind, key, time.Now().Unix()).Scan(&data)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal([]byte(data), v); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteState removes the record stored under kind/key.
+func (db *DB) DeleteState(kind, key string) error {
+	_, err := db.Exec("DELETE FROM state WHERE kind=? AND key=?", kind, key)
+	return err
+}
+
+// PurgeState deletes expired records and returns how many were removed.
+func (db *DB) PurgeState() (int64, error) {
+	res, err := db.Exec("DELETE FROM state WHERE expires_at<=?", time.Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
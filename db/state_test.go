@@ -0,0 +1,51 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestState(t *testing.T) {
+	database, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	type upload struct {
+		Step int `json:"step"`
+	}
+	if err := database.SaveState("upload", "1", upload{Step: 1}, time.Hour); err != nil {
+		t.Fatalf("SaveState: %v", err)
+	}
+	if err := database.SaveState("upload", "1", upload{Step: 2}, time.Hour); err != nil {
+		t.Fatalf("SaveState overwrite: %v", err)
+	}
+	var u upload
+	if ok, err := database.LoadState("upload", "1", &u); err != nil || !ok || u.Step != 2 {
+		t.Fatalf("LoadState: %v %v %+v", ok, err, u)
+	}
+	if ok, _ := database.LoadState("link", "1", &u); ok {
+		t.Fatal("state of another kind loaded")
+	}
+
+	// an expired record is invisible before it is purged
+	if err := database.SaveState("upload", "2", upload{Step: 1}, -time.Minute); err != nil {
+		t.Fatalf("SaveState: %v", err)
+	}
+	if ok, err := database.LoadState("upload", "2", &u); err != nil || ok {
+		t.Fatalf("expired state loaded: %v %v", ok, err)
+	}
+	if n, err := database.PurgeState(); err != nil || n != 1 {
+		t.Fatalf("PurgeState: %d %v", n, err)
+	}
+	if ok, _ := database.LoadState("upload", "1", &u); !ok {
+		t.Fatal("live state purged")
+	}
+
+	if err := database.DeleteState("upload", "1"); err != nil {
+		t.Fatalf("DeleteState: %v", err)
+	}
+	if ok, _ := database.LoadState("upload", "1", &u); ok {
+		t.Fatal("deleted state loaded")
+	}
+}
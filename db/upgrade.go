@@ -0,0 +1,74 @@
+package db
+
+import (
+	"database/sql"
+	"strconv"
+)
+
+// upgrades are data migrations applied in order; PRAGMA user_version holds
+// the number of upgrades already applied to the database.
+var upgrades = []string{
+	// 1: balances and payment amounts move from REAL USDT to INTEGER
+	// micro-USDT (see package money)
+	`CREATE TABLE users_new(
+                id INTEGER PRIMARY KEY,
+                telegram_id INTEGER UNIQUE,
+                balance INTEGER DEFAULT 0
+        );
+        INSERT INTO users_new(id, telegram_id, balance)
+                SELECT id, telegram_id, CAST(ROUND(COALESCE(balance, 0) * 1000000) AS INTEGER) FROM users;
+        DROP TABLE users;
+        ALTER TABLE users_new RENAME TO users;
+        CREATE TABLE payments_new(
+                id INTEGER PRIMARY KEY,
+                user_id INTEGER,
+                amount INTEGER,
+                provider TEXT,
+                invoice_id TEXT,
+                status TEXT DEFAULT 'paid',
+                created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                updated_at TIMESTAMP,
+                paid_at TIMESTAMP
+        );
+        INSERT INTO payments_new(id, user_id, amount, provider, invoice_id, status, created_at, updated_at, paid_at)
+                SELECT id, user_id, CAST(ROUND(COALESCE(amount, 0) * 1000000) AS INTEGER), provider, invoice_id, status, created_at, updated_at, paid_at FROM payments;
+        DROP TABLE payments;
+        ALTER TABLE payments_new RENAME TO payments;`,
+	// 2: balances may never go negative; overdrafts left by the old
+	// charge-after-upload flow are written off
+	`CREATE TABLE users_new(
+                id INTEGER PRIMARY KEY,
+                telegram_id INTEGER UNIQUE,
+                balance INTEGER DEFAULT 0 CHECK(balance >= 0)
+        );
+        INSERT INTO users_new(id, telegram_id, balance)
+                SELECT id, telegram_id, MAX(COALESCE(balance, 0), 0) FROM users;
+        DROP TABLE users;
+        ALTER TABLE users_new RENAME TO users;`,
+}
+
+func upgrade(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	for i := version; i < len(upgrades); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(upgrades[i]); err != nil {
+			tx.Rollback()
+			return err
+		}
+		// PRAGMA does not accept bound parameters
+		if _, err := tx.Exec("PRAGMA user_version=" + strconv.Itoa(i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
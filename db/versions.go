@@ -0,0 +1,99 @@
+package db
+
+import "github.com/example/filestoragebot/models"
+
+// ReplaceBlob makes blob the contents of file fileID. Up to keep previous
+// contents are kept as versions; the storage keys of contents dropped from
+// the file are returned so the caller can delete them.
+func (db *DB) ReplaceBlob(fileID int64, blob, fileName string, size int64, keep int) ([]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	f, err := scanFile(tx.QueryRow("SELECT "+fileColumns+" FROM files WHERE id=?", fileID))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE files SET blob=?, file_name=?, size=? WHERE id=?", blob, fileName, size, fileID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("INSERT INTO file_versions(file_id, blob, file_name, size) VALUES(?,?,?,?)",
+		fileID, f.Blob, f.FileName, f.Size); err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query("SELECT id, blob FROM file_versions WHERE file_id=? ORDER BY created_at DESC, id DESC LIMIT -1 OFFSET ?", fileID, keep)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	var drop []string
+	for rows.Next() {
+		var id int64
+		var b string
+		if err := rows.Scan(&id, &b); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+		drop = append(drop, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if _, err := tx.Exec("DELETE FROM file_versions WHERE id=?", id); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return drop, nil
+}
+
+// ListVersions returns the kept previous contents of a file, newest first.
+func (db *DB) ListVersions(fileID int64) ([]models.FileVersion, error) {
+	rows, err := db.Query("SELECT id, file_id, blob, COALESCE(file_name,''), size, created_at FROM file_versions WHERE file_id=? ORDER BY created_at DESC, id DESC", fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []models.FileVersion
+	for rows.Next() {
+		var v models.FileVersion
+		if err := rows.Scan(&v.ID, &v.FileID, &v.Blob, &v.FileName, &v.Size, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return res, rows.Err()
+}
+
+// RollbackVersion brings version versionID of file fileID back; the
+// contents it replaces are kept as a version in its place.
+func (db *DB) RollbackVersion(fileID, versionID int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var v models.FileVersion
+	if err := tx.QueryRow("SELECT blob, COALESCE(file_name,''), size FROM file_versions WHERE id=? AND file_id=?", versionID, fileID).
+		Scan(&v.Blob, &v.FileName, &v.Size); err != nil {
+		return err
+	}
+	f, err := scanFile(tx.QueryRow("SELECT "+fileColumns+" FROM files WHERE id=?", fileID))
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE file_versions SET blob=?, file_name=?, size=?, created_at=CURRENT_TIMESTAMP WHERE id=?",
+		f.Blob, f.FileName, f.Size, versionID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE files SET blob=?, file_name=?, size=? WHERE id=?", v.Blob, v.FileName, v.Size, fileID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/example/filestoragebot/models"
+)
+
+func TestReplaceBlob(t *testing.T) {
+	database, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	f := &models.File{UserID: 1, StorageName: "v1", Slug: "price", FileName: "price.pdf", Size: 10}
+	if err := database.AddFile(f); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := database.GetFileBySlug("price"); got.Blob != "v1" {
+		t.Fatalf("blob of a new file: %q", got.Blob)
+	}
+	for i, blob := range []string{"v2", "v3", "v4"} {
+		drop, err := database.ReplaceBlob(f.ID, blob, blob+".pdf", int64(20+i), 2)
+		if err != nil {
+			t.Fatalf("ReplaceBlob: %v", err)
+		}
+		// the third replacement pushes the oldest contents out
+		if want := i == 2; want != (len(drop) == 1 && drop[0] == "v1") {
+			t.Fatalf("replacement %d dropped %v", i+1, drop)
+		}
+	}
+	got, _ := database.GetFileBySlug("price")
+	if got.Blob != "v4" || got.FileName != "v4.pdf" || got.Size != 22 || got.StorageName != "v1" {
+		t.Fatalf("current contents: %+v", got)
+	}
+	versions, _ := database.ListVersions(f.ID)
+	if len(versions) != 2 || versions[0].Blob != "v3" || versions[1].Blob != "v2" {
+		t.Fatalf("versions: %+v", versions)
+	}
+
+	if err := database.RollbackVersion(f.ID+1, versions[1].ID); err == nil {
+		t.Fatal("rolled back a version of another file")
+	}
+	if err := database.RollbackVersion(f.ID, versions[1].ID); err != nil {
+		t.Fatalf("RollbackVersion: %v", err)
+	}
+	got, _ = database.GetFileBySlug("price")
+	if got.Blob != "v2" || got.Size != 20 {
+		t.Fatalf("after rollback: %+v", got)
+	}
+	versions, _ = database.ListVersions(f.ID)
+	if len(versions) != 2 {
+		t.Fatalf("versions after rollback: %+v", versions)
+	}
+	blobs := map[string]bool{versions[0].Blob: true, versions[1].Blob: true}
+	if !blobs["v3"] || !blobs["v4"] {
+		t.Fatalf("versions after rollback: %+v", versions)
+	}
+}
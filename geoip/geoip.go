@@ -0,0 +1,62 @@
+package geoip
+
+import (
+	"log"
+	"net"
+
+	"github.com/example/filestoragebot/config"
+)
+
+// Location is the coarse place an address belongs to. Country is an ISO
+// 3166-1 code.
+type Location struct {
+	City    string
+	Country string
+}
+
+// Resolver maps IP addresses to locations. An unknown address yields an
+// empty Location and no error.
+type Resolver interface {
+	Lookup(ip net.IP) (Location, error)
+}
+
+// Chain asks each resolver in turn until one returns a country.
+type Chain []Resolver
+
+func (c Chain) Lookup(ip net.IP) (Location, error) {
+	var loc Location
+	var lastErr error
+	for _, r := range c {
+		l, err := r.Lookup(ip)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if l.Country != "" {
+			return l, nil
+		}
+		loc = l
+	}
+	return loc, lastErr
+}
+
+// FromConfig builds the resolvers enabled in the configuration: the offline
+// database first and ipinfo.io as a fallback. The result is empty when
+// geolocation is disabled.
+func FromConfig(cfg *config.Config) (Chain, error) {
+	var c Chain
+	if cfg.GeoIPDatabase != "" {
+		db, err := OpenMMDB(cfg.GeoIPDatabase)
+		if err != nil {
+			return nil, err
+		}
+		c = append(c, db)
+	}
+	if cfg.IPInfo() {
+		c = append(c, &IPInfo{Token: cfg.IPInfoToken})
+	}
+	if len(c) == 0 {
+		log.Println("geoip: no geoip_database and ipinfo_enabled is off, download locations will not be logged")
+	}
+	return c, nil
+}
@@ -0,0 +1,130 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/example/filestoragebot/config"
+)
+
+// encode writes v in the MaxMind DB data format. Only the types needed for
+// the tests are supported.
+func encode(buf *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case string:
+		buf.WriteByte(2<<5 | byte(len(v)))
+		buf.WriteString(v)
+	case uint16:
+		buf.WriteByte(5<<5 | 2)
+		binary.Write(buf, binary.BigEndian, v)
+	case uint32:
+		buf.WriteByte(6<<5 | 4)
+		binary.Write(buf, binary.BigEndian, v)
+	case map[string]interface{}:
+		buf.WriteByte(7<<5 | byte(len(v)))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			encode(buf, k)
+			encode(buf, v[k])
+		}
+	}
+}
+
+// writeMMDB creates an IPv4 database with a single node: addresses in
+// 0.0.0.0/1 resolve to rec, the rest are unknown.
+func writeMMDB(t *testing.T, rec map[string]interface{}) string {
+	var buf bytes.Buffer
+	const nodes = 1
+	// 24-bit records: left points at the first data entry, right is empty
+	left := nodes + 16
+	buf.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left), 0, 0, nodes})
+	buf.Write(make([]byte, 16))
+	encode(&buf, rec)
+	buf.WriteString("\xAB\xCD\xEFMaxMind.com")
+	encode(&buf, map[string]interface{}{
+		"node_count":                  uint32(nodes),
+		"record_size":                 uint16(24),
+		"ip_version":                  uint16(4),
+		"database_type":               "Test-City",
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+	})
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMMDB(t *testing.T) {
+	path := writeMMDB(t, map[string]interface{}{
+		"city":    map[string]interface{}{"names": map[string]interface{}{"en": "Berlin"}},
+		"country": map[string]interface{}{"iso_code": "DE"},
+	})
+	db, err := OpenMMDB(path)
+	if err != nil {
+		t.Fatalf("OpenMMDB: %v", err)
+	}
+	defer db.Close()
+	loc, err := db.Lookup(net.ParseIP("1.2.3.4"))
+	if err != nil || loc != (Location{City: "Berlin", Country: "DE"}) {
+		t.Fatalf("got %+v, %v", loc, err)
+	}
+	loc, err = db.Lookup(net.ParseIP("200.1.1.1"))
+	if err != nil || loc != (Location{}) {
+		t.Fatalf("unknown address got %+v, %v", loc, err)
+	}
+}
+
+func TestChainFallback(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path != "/200.1.1.1/json" || r.URL.Query().Get("token") != "tok" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		w.Write([]byte(`{"ip":"200.1.1.1","city":"Lima","country":"PE"}`))
+	}))
+	defer ts.Close()
+	old := ipinfoBase
+	ipinfoBase = ts.URL
+	defer func() { ipinfoBase = old }()
+
+	db, err := OpenMMDB(writeMMDB(t, map[string]interface{}{
+		"country": map[string]interface{}{"iso_code": "DE"},
+	}))
+	if err != nil {
+		t.Fatalf("OpenMMDB: %v", err)
+	}
+	defer db.Close()
+	c := Chain{db, &IPInfo{Token: "tok"}}
+	if loc, _ := c.Lookup(net.ParseIP("1.2.3.4")); loc.Country != "DE" || calls != 0 {
+		t.Fatalf("offline lookup got %+v after %d calls", loc, calls)
+	}
+	if loc, _ := c.Lookup(net.ParseIP("200.1.1.1")); loc != (Location{City: "Lima", Country: "PE"}) {
+		t.Fatalf("fallback got %+v", loc)
+	}
+}
+
+func TestFromConfigIPInfoDefault(t *testing.T) {
+	// configs written before ipinfo_enabled keep ipinfo
+	c, err := FromConfig(&config.Config{})
+	if err != nil || len(c) != 1 {
+		t.Fatalf("legacy config: %v %v", c, err)
+	}
+	c, err = FromConfig(&config.Config{IPInfoEnabled: new(bool)})
+	if err != nil || len(c) != 0 {
+		t.Fatalf("ipinfo_enabled: false: %v %v", c, err)
+	}
+}
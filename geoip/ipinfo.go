@@ -0,0 +1,48 @@
+package geoip
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var ipinfoBase = "https://ipinfo.io"
+
+// IPInfo queries the ipinfo.io API. It needs outbound network access.
+type IPInfo struct {
+	Token  string
+	Client *http.Client
+}
+
+func (p *IPInfo) client() *http.Client {
+	if p.Client != nil {
+		return p.Client
+	}
+	return &http.Client{Timeout: 5 * time.Second}
+}
+
+func (p *IPInfo) Lookup(ip net.IP) (Location, error) {
+	u := ipinfoBase + "/" + ip.String() + "/json"
+	if p.Token != "" {
+		u += "?token=" + url.QueryEscape(p.Token)
+	}
+	resp, err := p.client().Get(u)
+	if err != nil {
+		return Location{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Location{}, fmt.Errorf("ipinfo HTTP %d", resp.StatusCode)
+	}
+	var loc struct {
+		City    string `json:"city"`
+		Country string `json:"country"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&loc); err != nil {
+		return Location{}, err
+	}
+	return Location{City: loc.City, Country: loc.Country}, nil
+}
@@ -0,0 +1,43 @@
+package geoip
+
+import (
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// MMDB resolves addresses offline from a MaxMind-format database such as
+// GeoLite2-City or DB-IP City Lite.
+type MMDB struct {
+	r *maxminddb.Reader
+}
+
+// OpenMMDB loads the .mmdb file at path.
+func OpenMMDB(path string) (*MMDB, error) {
+	r, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &MMDB{r: r}, nil
+}
+
+type mmdbRecord struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+
+func (m *MMDB) Lookup(ip net.IP) (Location, error) {
+	var rec mmdbRecord
+	if err := m.r.Lookup(ip, &rec); err != nil {
+		return Location{}, err
+	}
+	return Location{City: rec.City.Names["en"], Country: rec.Country.ISOCode}, nil
+}
+
+func (m *MMDB) Close() error {
+	return m.r.Close()
+}
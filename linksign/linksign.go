@@ -0,0 +1,65 @@
+package linksign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+func mac(secret []byte, slug string, exp int64) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(slug + "|" + strconv.FormatInt(exp, 10)))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// Sign returns link extended with ?exp=<unix time>&sig=<HMAC>, which keeps it
+// valid until exp. The signature covers the last path element of link.
+func Sign(secret []byte, link string, exp time.Time) (string, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	SignQuery(secret, lastElem(u.Path), q, exp)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// SignQuery sets exp and sig in q so that it is valid for slug until exp.
+func SignQuery(secret []byte, slug string, q url.Values, exp time.Time) {
+	q.Set("exp", strconv.FormatInt(exp.Unix(), 10))
+	q.Set("sig", mac(secret, slug, exp.Unix()))
+}
+
+// Signed reports whether q carries a signature at all.
+func Signed(q url.Values) bool {
+	return q.Get("sig") != ""
+}
+
+// Check verifies the signature in q for slug. ok is false for a forged or
+// malformed signature; expired reports a genuine signature past its time.
+func Check(secret []byte, slug string, q url.Values, now time.Time) (ok, expired bool) {
+	exp, err := strconv.ParseInt(q.Get("exp"), 10, 64)
+	if err != nil {
+		return false, false
+	}
+	if !hmac.Equal([]byte(q.Get("sig")), []byte(mac(secret, slug, exp))) {
+		return false, false
+	}
+	if now.Unix() >= exp {
+		return false, true
+	}
+	return true, false
+}
+
+func lastElem(p string) string {
+	for i := len(p) - 1; i >= 0; i-- {
+		if p[i] == '/' {
+			return p[i+1:]
+		}
+	}
+	return p
+}
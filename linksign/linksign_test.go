@@ -0,0 +1,37 @@
+package linksign
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSignCheck(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Unix(1700000000, 0)
+	signed, err := Sign(secret, "https://files.example/report", now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	u, _ := url.Parse(signed)
+	q := u.Query()
+	if !Signed(q) {
+		t.Fatalf("no signature in %s", signed)
+	}
+	if ok, _ := Check(secret, "report", q, now); !ok {
+		t.Fatalf("valid signature rejected")
+	}
+	if ok, expired := Check(secret, "report", q, now.Add(2*time.Hour)); ok || !expired {
+		t.Fatalf("expired signature: ok=%v expired=%v", ok, expired)
+	}
+	if ok, expired := Check(secret, "other", q, now); ok || expired {
+		t.Fatalf("signature accepted for another slug")
+	}
+	if ok, _ := Check([]byte("wrong"), "report", q, now); ok {
+		t.Fatalf("signature accepted with another secret")
+	}
+	q.Set("exp", "1800000000")
+	if ok, _ := Check(secret, "report", q, now); ok {
+		t.Fatalf("extended expiry accepted")
+	}
+}
@@ -3,6 +3,8 @@ package logdb
 import (
 	"database/sql"
 	"fmt"
+	"strconv"
+	"strings"
 
 	_ "modernc.org/sqlite"
 )
@@ -12,10 +14,23 @@ type DB struct {
 	*sql.DB
 }
 
+// Kinds of logged events.
+const (
+	EventDownload    = "download"
+	EventBadPassword = "bad_password"
+)
+
 // Entry represents a single download event.
 type Entry struct {
-	ID          int64
-	CreatedAt   string
+	ID        int64
+	CreatedAt string
+	Event     string
+	// Slug is the link or alias the file was requested under, empty for
+	// entries logged before it was recorded.
+	Slug string
+	// Bot marks requests from crawlers, link previews and other automated
+	// clients.
+	Bot         bool
 	IP          string
 	City        string
 	Country     string
@@ -27,55 +42,119 @@ type Entry struct {
 	BrowserVer  string
 }
 
+const entryColumns = "ip, city, country, platform, model, os_name, os_version, browser_name, browser_ver"
+
 // New opens database at given path creating file if needed.
 func New(path string) (*DB, error) {
-	database, err := sql.Open("sqlite", path)
+	database, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_txlock=immediate")
 	if err != nil {
 		return nil, err
 	}
+	if err := migrate(database); err != nil {
+		return nil, err
+	}
 	return &DB{database}, nil
 }
 
-func tableName(fileID int64) string {
-	return fmt.Sprintf("log_%d", fileID)
+func migrate(db *sql.DB) error {
+	queries := []string{
+		`CREATE TABLE IF NOT EXISTS downloads(
+                        id INTEGER PRIMARY KEY,
+                        file_id INTEGER NOT NULL,
+                        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                        ip TEXT,
+                        city TEXT,
+                        country TEXT,
+                        platform TEXT,
+                        model TEXT,
+                        os_name TEXT,
+                        os_version TEXT,
+                        browser_name TEXT,
+                        browser_ver TEXT,
+                        event TEXT DEFAULT 'download',
+                        bot INTEGER DEFAULT 0,
+                        slug TEXT DEFAULT ''
+                );`,
+		`CREATE INDEX IF NOT EXISTS downloads_file ON downloads(file_id, created_at)`,
+	}
+	for _, q := range queries {
+		if _, err := db.Exec(q); err != nil {
+			return err
+		}
+	}
+	db.Exec("ALTER TABLE downloads ADD COLUMN event TEXT DEFAULT 'download'")
+	db.Exec("ALTER TABLE downloads ADD COLUMN bot INTEGER DEFAULT 0")
+	db.Exec("ALTER TABLE downloads ADD COLUMN slug TEXT DEFAULT ''")
+	return foldLegacyTables(db)
 }
 
-func (db *DB) ensureTable(fileID int64) error {
-	q := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
-        id INTEGER PRIMARY KEY,
-        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-        ip TEXT,
-        city TEXT,
-        country TEXT,
-        platform TEXT,
-        model TEXT,
-        os_name TEXT,
-        os_version TEXT,
-        browser_name TEXT,
-        browser_ver TEXT
-    );`, tableName(fileID))
-	_, err := db.Exec(q)
-	return err
+// foldLegacyTables moves rows from the old per-file log_<fileID> tables into
+// downloads and drops them. Each table is moved in its own transaction so an
+// interrupted migration resumes where it stopped.
+func foldLegacyTables(db *sql.DB) error {
+	rows, err := db.Query(`SELECT name FROM sqlite_master WHERE type='table' AND name LIKE 'log\_%' ESCAPE '\'`)
+	if err != nil {
+		return err
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, name := range tables {
+		fileID, err := strconv.ParseInt(strings.TrimPrefix(name, "log_"), 10, 64)
+		if err != nil {
+			continue
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		q := fmt.Sprintf(`INSERT INTO downloads(file_id, created_at, %s)
+                SELECT ?, created_at, %s FROM %s ORDER BY created_at, id`, entryColumns, entryColumns, name)
+		if _, err := tx.Exec(q, fileID); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.Exec("DROP TABLE " + name); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// Add stores a download entry for given file.
+// Add stores a download entry for given file. An empty Event is logged as
+// a download.
 func (db *DB) Add(fileID int64, e *Entry) error {
-	if err := db.ensureTable(fileID); err != nil {
-		return err
+	event := e.Event
+	if event == "" {
+		event = EventDownload
 	}
-	q := fmt.Sprintf(`INSERT INTO %s(ip, city, country, platform, model, os_name, os_version, browser_name, browser_ver)
-        VALUES(?,?,?,?,?,?,?,?,?)`, tableName(fileID))
-	_, err := db.Exec(q, e.IP, e.City, e.Country, e.Platform, e.Model, e.OSName, e.OSVersion, e.BrowserName, e.BrowserVer)
+	bot := 0
+	if e.Bot {
+		bot = 1
+	}
+	_, err := db.Exec(`INSERT INTO downloads(file_id, event, bot, slug, `+entryColumns+`) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		fileID, event, bot, e.Slug, e.IP, e.City, e.Country, e.Platform, e.Model, e.OSName, e.OSVersion, e.BrowserName, e.BrowserVer)
 	return err
 }
 
 // List returns all entries for file sorted by creation time ascending.
 func (db *DB) List(fileID int64) ([]Entry, error) {
-	if err := db.ensureTable(fileID); err != nil {
-		return nil, err
-	}
-	q := fmt.Sprintf(`SELECT id, created_at, ip, city, country, platform, model, os_name, os_version, browser_name, browser_ver FROM %s ORDER BY created_at ASC`, tableName(fileID))
-	rows, err := db.Query(q)
+	rows, err := db.Query(`SELECT id, created_at, COALESCE(event, 'download'), COALESCE(bot, 0), COALESCE(slug, ''), `+entryColumns+` FROM downloads
+                WHERE file_id=? ORDER BY created_at ASC, id ASC`, fileID)
 	if err != nil {
 		return nil, err
 	}
@@ -83,17 +162,39 @@ func (db *DB) List(fileID int64) ([]Entry, error) {
 	var res []Entry
 	for rows.Next() {
 		var e Entry
-		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.IP, &e.City, &e.Country, &e.Platform, &e.Model, &e.OSName, &e.OSVersion, &e.BrowserName, &e.BrowserVer); err != nil {
+		var bot int
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.Event, &bot, &e.Slug, &e.IP, &e.City, &e.Country, &e.Platform, &e.Model, &e.OSName, &e.OSVersion, &e.BrowserName, &e.BrowserVer); err != nil {
 			return nil, err
 		}
+		e.Bot = bot == 1
 		res = append(res, e)
 	}
 	return res, rows.Err()
 }
 
-// Drop removes log table for file if exists.
+// CountBySlug returns how many downloads of file, excluding bots, came
+// through each link or alias.
+func (db *DB) CountBySlug(fileID int64) (map[string]int, error) {
+	rows, err := db.Query(`SELECT COALESCE(slug, ''), COUNT(*) FROM downloads
+                WHERE file_id=? AND COALESCE(event, 'download')=? AND COALESCE(bot, 0)=0 GROUP BY 1`, fileID, EventDownload)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make(map[string]int)
+	for rows.Next() {
+		var s string
+		var n int
+		if err := rows.Scan(&s, &n); err != nil {
+			return nil, err
+		}
+		res[s] = n
+	}
+	return res, rows.Err()
+}
+
+// Drop removes all log entries of file.
 func (db *DB) Drop(fileID int64) error {
-	q := fmt.Sprintf(`DROP TABLE IF EXISTS %s`, tableName(fileID))
-	_, err := db.Exec(q)
+	_, err := db.Exec("DELETE FROM downloads WHERE file_id=?", fileID)
 	return err
 }
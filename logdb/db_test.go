@@ -0,0 +1,81 @@
+package logdb
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestFoldLegacyTables(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs.db")
+	old, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []string{
+		`CREATE TABLE log_7 (id INTEGER PRIMARY KEY, created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, ip TEXT, city TEXT, country TEXT,
+                platform TEXT, model TEXT, os_name TEXT, os_version TEXT, browser_name TEXT, browser_ver TEXT)`,
+		`INSERT INTO log_7(created_at, ip, city, country, platform, model, os_name, os_version, browser_name, browser_ver)
+                VALUES('2024-01-02 00:00:00','2.2.2.2','','','','','','','',''), ('2024-01-01 00:00:00','1.1.1.1','','','','','','','','')`,
+	} {
+		if _, err := old.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old.Close()
+
+	logs, err := New(path)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := logs.Add(8, &Entry{IP: "3.3.3.3"}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	entries, err := logs.List(7)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(entries) != 2 || entries[0].IP != "1.1.1.1" || entries[1].IP != "2.2.2.2" {
+		t.Fatalf("entries %+v", entries)
+	}
+	var n int
+	logs.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name='log_7'").Scan(&n)
+	if n != 0 {
+		t.Fatalf("legacy table kept")
+	}
+	if err := logs.Drop(7); err != nil {
+		t.Fatalf("Drop: %v", err)
+	}
+	if entries, _ := logs.List(7); len(entries) != 0 {
+		t.Fatalf("entries left after Drop: %d", len(entries))
+	}
+	if entries, _ := logs.List(8); len(entries) != 1 {
+		t.Fatalf("other file lost entries")
+	}
+}
+
+func TestCountBySlug(t *testing.T) {
+	logs, err := New(filepath.Join(t.TempDir(), "logs.db"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for _, e := range []Entry{
+		{Slug: "price"},
+		{Slug: "price"},
+		{Slug: "price-2026"},
+		{Slug: "price-2026", Bot: true},
+		{Slug: "price", Event: EventBadPassword},
+		{},
+	} {
+		if err := logs.Add(1, &e); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	counts, err := logs.CountBySlug(1)
+	if err != nil {
+		t.Fatalf("CountBySlug: %v", err)
+	}
+	if len(counts) != 3 || counts["price"] != 2 || counts["price-2026"] != 1 || counts[""] != 1 {
+		t.Fatalf("counts %v", counts)
+	}
+}
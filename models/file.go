@@ -1,12 +1,69 @@
 package models
 
 type File struct {
-	ID          int64
-	UserID      int64
-	LocalName   string
+	ID        int64
+	UserID    int64
+	LocalName string
+	// FileName is the original name of the uploaded document.
+	FileName string
+	// StorageName identifies the file; Blob is the storage key of its
+	// current contents, which changes when the contents are replaced.
 	StorageName string
-	Link        string
-	Notify      bool
-	Size        int64
-	CreatedAt   string
+	Blob        string
+	// Slug is the link part after the domain; URLs are built from it
+	// when shown.
+	Slug      string
+	Notify    bool
+	Size      int64
+	CreatedAt string
+	// ExpiresAt is the unix time the link stops working, 0 for never.
+	ExpiresAt int64
+	// MaxDownloads limits how often the file may be downloaded, 0 for no
+	// limit. Downloads counts the downloads so far.
+	MaxDownloads int
+	Downloads    int
+	// PasswordHash is the bcrypt hash of the download password, empty when
+	// the link is open.
+	PasswordHash string
+	// OneTime links stop working after the first complete download, which
+	// sets Consumed.
+	OneTime  bool
+	Consumed bool
+	// SignedOnly refuses downloads through the bare link; only signed
+	// temporary URLs work.
+	SignedOnly bool
+	// Landing shows an HTML page with Description and a download button
+	// instead of streaming the file right away.
+	Landing     bool
+	Description string
+	// Aliases are loaded on demand by db.LoadAliases.
+	Aliases []Alias
+}
+
+// OldLink is a slug a file was published under before its link changed.
+// Requests for it are sent to the current link.
+type OldLink struct {
+	ID        int64
+	FileID    int64
+	Slug      string
+	CreatedAt string
+}
+
+// Alias is an extra slug a file is served under, with its own download
+// statistics.
+type Alias struct {
+	ID        int64
+	FileID    int64
+	Slug      string
+	CreatedAt string
+}
+
+// FileVersion is earlier contents of a file kept for rollback.
+type FileVersion struct {
+	ID        int64
+	FileID    int64
+	Blob      string
+	FileName  string
+	Size      int64
+	CreatedAt string
 }
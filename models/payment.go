@@ -0,0 +1,22 @@
+package models
+
+import "github.com/example/filestoragebot/money"
+
+// Payment statuses.
+const (
+	PaymentPending = "pending"
+	PaymentPaid    = "paid"
+	PaymentExpired = "expired"
+)
+
+type Payment struct {
+	ID        int64
+	UserID    int64
+	Amount    money.Amount
+	Provider  string
+	InvoiceID string
+	Status    string
+	CreatedAt string
+	UpdatedAt string
+	PaidAt    string
+}
@@ -1,7 +1,9 @@
 package models
 
+import "github.com/example/filestoragebot/money"
+
 type User struct {
 	ID         int64
 	TelegramID int64
-	Balance    float64
+	Balance    money.Amount
 }
@@ -0,0 +1,93 @@
+package money
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Amount is a sum of USDT kept in millionths (micro-USDT) so that balances
+// and prices add up exactly.
+type Amount int64
+
+const (
+	Micro Amount = 1
+	USDT  Amount = 1000000
+)
+
+const decimals = 6
+
+var errFormat = errors.New("money: invalid amount")
+
+// Parse reads a decimal USDT amount such as "1", "0.5" or "2,75". At most
+// six fractional digits are accepted.
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(strings.Replace(s, ",", ".", 1))
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" || len(frac) > decimals {
+		return 0, errFormat
+	}
+	for _, part := range []string{whole, frac} {
+		for _, c := range part {
+			if c < '0' || c > '9' {
+				return 0, errFormat
+			}
+		}
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	w, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || w > int64(^uint64(0)>>1)/int64(USDT)-1 {
+		return 0, errFormat
+	}
+	f := int64(0)
+	if frac != "" {
+		f, _ = strconv.ParseInt(frac+strings.Repeat("0", decimals-len(frac)), 10, 64)
+	}
+	a := Amount(w)*USDT + Amount(f)
+	if neg {
+		a = -a
+	}
+	return a, nil
+}
+
+// String formats the amount with at least two and at most six fractional
+// digits, e.g. "1.50" or "0.000001".
+func (a Amount) String() string {
+	sign := ""
+	if a < 0 {
+		sign = "-"
+		a = -a
+	}
+	frac := strconv.FormatInt(int64(a%USDT)+int64(USDT), 10)[1:]
+	frac = strings.TrimRight(frac, "0")
+	for len(frac) < 2 {
+		frac += "0"
+	}
+	return sign + strconv.FormatInt(int64(a/USDT), 10) + "." + frac
+}
+
+// UnmarshalYAML parses the scalar text directly so values in the config
+// never pass through float64.
+func (a *Amount) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// MarshalYAML writes the exact decimal, e.g. "0.00005", so that it reads back
+// through Parse; a float64 would come out as 5e-05.
+func (a Amount) MarshalYAML() (interface{}, error) {
+	// String always has a fractional part, so only its padding is trimmed
+	return strings.TrimSuffix(strings.TrimRight(a.String(), "0"), "."), nil
+}
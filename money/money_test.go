@@ -0,0 +1,86 @@
+package money
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestParse(t *testing.T) {
+	cases := map[string]Amount{
+		"1":        USDT,
+		"0.1":      100000,
+		"2,75":     2750000,
+		".5":       500000,
+		"-0.3":     -300000,
+		"0.000001": 1,
+		"10000":    10000 * USDT,
+	}
+	for in, want := range cases {
+		got, err := Parse(in)
+		if err != nil || got != want {
+			t.Errorf("Parse(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "abc", "1.0000001", "1e3", "1.2.3", "--1"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Parse(%q) accepted", bad)
+		}
+	}
+}
+
+func TestExactSum(t *testing.T) {
+	a, _ := Parse("0.1")
+	b, _ := Parse("0.2")
+	if s := (a + b).String(); s != "0.30" {
+		t.Fatalf("0.1+0.2 = %s", s)
+	}
+}
+
+func TestString(t *testing.T) {
+	cases := map[Amount]string{
+		0:            "0.00",
+		USDT:         "1.00",
+		1500000:      "1.50",
+		1:            "0.000001",
+		-2500000:     "-2.50",
+		123456789012: "123456.789012",
+	}
+	for in, want := range cases {
+		if got := in.String(); got != want {
+			t.Errorf("%d.String() = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestYAML(t *testing.T) {
+	var cfg struct {
+		Price Amount `yaml:"price"`
+		Min   Amount `yaml:"min"`
+	}
+	if err := yaml.Unmarshal([]byte("price: 1\nmin: 0.1\n"), &cfg); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if cfg.Price != USDT || cfg.Min != 100000 {
+		t.Fatalf("got %d %d", cfg.Price, cfg.Min)
+	}
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if string(data) != "price: \"1\"\nmin: \"0.1\"\n" {
+		t.Fatalf("marshal: %q", data)
+	}
+	// tiny amounts such as a stars_rate survive a config rewrite
+	for _, a := range []Amount{50, 1, 10 * USDT, -150000} {
+		cfg.Price = a
+		data, err := yaml.Marshal(cfg)
+		if err != nil {
+			t.Fatalf("marshal %d: %v", a, err)
+		}
+		cfg.Price = 0
+		if err := yaml.Unmarshal(data, &cfg); err != nil || cfg.Price != a {
+			t.Fatalf("round trip of %d via %q: %d %v", a, data, cfg.Price, err)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package payments
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/example/filestoragebot/money"
+)
+
+var cryptoAPIBase = "https://pay.crypt.bot/api/"
+
+// CryptoBot issues USDT invoices through @CryptoBot (Crypto Pay API).
+type CryptoBot struct {
+	Token   string
+	Min     money.Amount
+	Expires time.Duration
+}
+
+func (c *CryptoBot) Name() string           { return "crypto" }
+func (c *CryptoBot) Title() string          { return "CryptoBot" }
+func (c *CryptoBot) MinTopup() money.Amount { return c.Min }
+
+func (c *CryptoBot) do(method, body string) ([]byte, error) {
+	req, err := http.NewRequest("POST", cryptoAPIBase+method, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Crypto-Pay-API-Token", c.Token)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("CryptoBot request: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("CryptoBot read: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CryptoBot HTTP %d: %s", resp.StatusCode, string(data))
+	}
+	return data, nil
+}
+
+func (c *CryptoBot) CreateInvoice(amount money.Amount) (*Invoice, error) {
+	body := fmt.Sprintf(`{"asset":"USDT","amount":"%s","description":"Пополнение счёта на %s$"`, amount, amount)
+	if c.Expires > 0 {
+		body += fmt.Sprintf(`,"expires_in":%d`, int(c.Expires.Seconds()))
+	}
+	data, err := c.do("createInvoice", body+"}")
+	if err != nil {
+		return nil, err
+	}
+	var r struct {
+		Ok     bool `json:"ok"`
+		Result struct {
+			InvoiceID json.Number `json:"invoice_id"`
+			PayURL    string      `json:"pay_url"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("CryptoBot decode: %w", err)
+	}
+	if !r.Ok {
+		return nil, fmt.Errorf("CryptoBot API error: %s", string(data))
+	}
+	return &Invoice{ID: r.Result.InvoiceID.String(), URL: r.Result.PayURL, Amount: amount}, nil
+}
+
+func (c *CryptoBot) CheckInvoice(id string) (bool, error) {
+	data, err := c.do("getInvoices", fmt.Sprintf(`{"invoice_ids":[%s]}`, id))
+	if err != nil {
+		return false, err
+	}
+	var r struct {
+		Ok     bool `json:"ok"`
+		Result struct {
+			Items []struct {
+				Status string `json:"status"`
+			} `json:"items"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return false, fmt.Errorf("CryptoBot decode: %w", err)
+	}
+	if !r.Ok || len(r.Result.Items) == 0 {
+		return false, fmt.Errorf("CryptoBot API error: %s", string(data))
+	}
+	return r.Result.Items[0].Status == "paid", nil
+}
+
+func (c *CryptoBot) HealthCheck() error {
+	req, err := http.NewRequest("GET", cryptoAPIBase+"getMe", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Crypto-Pay-API-Token", c.Token)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s", strings.TrimSpace(string(data)))
+	}
+	return nil
+}
+
+func (c *CryptoBot) WebhookPath() string { return "/webhook/cryptobot" }
+
+// ParseWebhook handles invoice_paid updates signed in the
+// crypto-pay-api-signature header.
+func (c *CryptoBot) ParseWebhook(header http.Header, body []byte) (string, bool, error) {
+	if !validSignature(c.Token, body, header.Get("crypto-pay-api-signature")) {
+		return "", false, ErrSignature
+	}
+	var u struct {
+		UpdateType string `json:"update_type"`
+		Payload    struct {
+			InvoiceID json.Number `json:"invoice_id"`
+			Status    string      `json:"status"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &u); err != nil {
+		return "", false, err
+	}
+	paid := u.UpdateType == "invoice_paid" && u.Payload.Status == "paid"
+	return u.Payload.InvoiceID.String(), paid, nil
+}
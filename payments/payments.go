@@ -0,0 +1,98 @@
+package payments
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/example/filestoragebot/config"
+	"github.com/example/filestoragebot/money"
+)
+
+// httpClient is used for provider API calls. The timeout keeps a hung
+// request from stalling the invoice poller.
+var httpClient = &http.Client{Timeout: 15 * time.Second}
+
+// Invoice is a payment request issued by a provider. Amount is the balance
+// credited once it is paid.
+type Invoice struct {
+	ID     string
+	URL    string
+	Amount money.Amount
+}
+
+// Provider is a payment service able to issue and check invoices.
+type Provider interface {
+	// Name is the stable key stored with payments, e.g. "crypto".
+	Name() string
+	// Title is shown to users when choosing how to pay.
+	Title() string
+	MinTopup() money.Amount
+	CreateInvoice(amount money.Amount) (*Invoice, error)
+	CheckInvoice(id string) (bool, error)
+	HealthCheck() error
+}
+
+// Webhook is implemented by providers that push payment updates.
+type Webhook interface {
+	// WebhookPath is the HTTP path the provider posts updates to.
+	WebhookPath() string
+	// ParseWebhook verifies an update and returns the invoice it reports
+	// and whether that invoice is paid.
+	ParseWebhook(header http.Header, body []byte) (string, bool, error)
+}
+
+// Registry keeps enabled providers in the order they are offered to users.
+type Registry struct {
+	providers []Provider
+}
+
+func NewRegistry(providers ...Provider) *Registry {
+	return &Registry{providers: providers}
+}
+
+// FromConfig registers every provider that has a token configured.
+func FromConfig(cfg *config.Config) *Registry {
+	expires := time.Hour
+	if cfg.InvoiceTimeout > 0 {
+		expires = time.Duration(cfg.InvoiceTimeout) * time.Minute
+	}
+	r := NewRegistry()
+	if cfg.CryptoBotToken != "" {
+		r.Register(&CryptoBot{Token: cfg.CryptoBotToken, Min: cfg.CryptoMinTopup, Expires: expires})
+	}
+	if cfg.XRocketToken != "" {
+		r.Register(&XRocket{Token: cfg.XRocketToken, Min: cfg.XRocketMinTopup, Expires: expires})
+	}
+	return r
+}
+
+func (r *Registry) Register(p Provider) {
+	r.providers = append(r.providers, p)
+}
+
+// Providers returns all enabled providers.
+func (r *Registry) Providers() []Provider {
+	if r == nil {
+		return nil
+	}
+	return r.providers
+}
+
+// Get returns the provider registered under name.
+func (r *Registry) Get(name string) (Provider, error) {
+	for _, p := range r.Providers() {
+		if p.Name() == name {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("provider %q disabled", name)
+}
+
+// Default returns the first enabled provider.
+func (r *Registry) Default() (Provider, error) {
+	if ps := r.Providers(); len(ps) > 0 {
+		return ps[0], nil
+	}
+	return nil, fmt.Errorf("нет провайдера оплаты")
+}
@@ -0,0 +1,160 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/example/filestoragebot/config"
+	"github.com/example/filestoragebot/money"
+)
+
+func TestCryptoProvider(t *testing.T) {
+	token := os.Getenv("CRYPTOBOT_TOKEN")
+	if token == "" {
+		t.Skip("no token")
+	}
+	c := &CryptoBot{Token: token}
+	inv, err := c.CreateInvoice(money.USDT / 100)
+	if err != nil {
+		t.Fatalf("CreateInvoice: %v", err)
+	}
+	if inv.URL == "" || inv.ID == "" {
+		t.Fatalf("invalid data")
+	}
+	paid, err := c.CheckInvoice(inv.ID)
+	if err != nil {
+		t.Fatalf("CheckInvoice: %v", err)
+	}
+	if paid {
+		t.Fatalf("invoice unexpectedly paid")
+	}
+}
+
+func TestXRocketProvider(t *testing.T) {
+	token := os.Getenv("XROCKET_TOKEN")
+	if token == "" {
+		t.Skip("no token")
+	}
+	x := &XRocket{Token: token}
+	inv, err := x.CreateInvoice(money.USDT / 100)
+	if err != nil {
+		t.Fatalf("CreateInvoice: %v", err)
+	}
+	if inv.URL == "" || inv.ID == "" {
+		t.Fatalf("invalid data")
+	}
+	paid, err := x.CheckInvoice(inv.ID)
+	if err != nil {
+		t.Fatalf("CheckInvoice: %v", err)
+	}
+	if paid {
+		t.Fatalf("invoice unexpectedly paid")
+	}
+}
+
+func TestCheckCryptoInvoicePaid(t *testing.T) {
+	token := os.Getenv("CRYPTOBOT_TOKEN")
+	if token == "" {
+		t.Skip("no token")
+	}
+	paid, err := (&CryptoBot{Token: token}).CheckInvoice("29143188")
+	if err != nil {
+		t.Fatalf("CheckInvoice: %v", err)
+	}
+	if !paid {
+		t.Fatalf("expected invoice to be paid")
+	}
+}
+
+func TestCheckCryptoInvoiceUnpaid(t *testing.T) {
+	token := os.Getenv("CRYPTOBOT_TOKEN")
+	if token == "" {
+		t.Skip("no token")
+	}
+	paid, err := (&CryptoBot{Token: token}).CheckInvoice("29104962")
+	if err != nil {
+		t.Fatalf("CheckInvoice: %v", err)
+	}
+	if paid {
+		t.Fatalf("expected invoice to be unpaid")
+	}
+}
+
+func TestXRocketDecodeSuccess(t *testing.T) {
+	data := []byte(`{"success":true,"data":{"id":"42","link":"https://t.me/xrocket?start=inv_test","status":"active"}}`)
+	var res struct {
+		Ok      bool `json:"ok"`
+		Success bool `json:"success"`
+		Result  struct {
+			ID  string `json:"id"`
+			URL string `json:"url"`
+		} `json:"result"`
+		Data struct {
+			ID     json.Number `json:"id"`
+			Link   string      `json:"link"`
+			Status string      `json:"status"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &res); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !res.Success || res.Data.ID != "42" || res.Data.Link == "" {
+		t.Fatalf("unexpected decode result: %+v", res)
+	}
+}
+
+func TestCheckCryptoInvoiceError(t *testing.T) {
+	var method string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		http.Error(w, "fail", http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+	old := cryptoAPIBase
+	cryptoAPIBase = ts.URL + "/"
+	defer func() { cryptoAPIBase = old }()
+	if _, err := (&CryptoBot{Token: "t"}).CheckInvoice("1"); err == nil {
+		t.Fatalf("expected error")
+	}
+	if method != http.MethodPost {
+		t.Fatalf("expected POST request, got %s", method)
+	}
+}
+
+func TestRegistryFromConfig(t *testing.T) {
+	r := FromConfig(&config.Config{XRocketToken: "x"})
+	if len(r.Providers()) != 1 {
+		t.Fatalf("providers: %d", len(r.Providers()))
+	}
+	if _, err := r.Get("crypto"); err == nil {
+		t.Fatalf("disabled provider returned")
+	}
+	p, err := r.Default()
+	if err != nil || p.Name() != "xrocket" {
+		t.Fatalf("default: %v %v", p, err)
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	body := []byte(`{"type":"invoicePay","data":{"id":1234,"status":"paid"}}`)
+	secret := sha256.Sum256([]byte("token"))
+	mac := hmac.New(sha256.New, secret[:])
+	mac.Write(body)
+	h := http.Header{}
+	h.Set("rocket-pay-signature", hex.EncodeToString(mac.Sum(nil)))
+
+	x := &XRocket{Token: "token"}
+	id, paid, err := x.ParseWebhook(h, body)
+	if err != nil || id != "1234" || !paid {
+		t.Fatalf("got %q %v %v", id, paid, err)
+	}
+	if _, _, err := (&XRocket{Token: "other"}).ParseWebhook(h, body); err != ErrSignature {
+		t.Fatalf("expected ErrSignature, got %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package payments
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/example/filestoragebot/money"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Requester performs raw Bot API calls; *tgbotapi.BotAPI implements it.
+type Requester interface {
+	MakeRequest(endpoint string, params tgbotapi.Params) (*tgbotapi.APIResponse, error)
+}
+
+// ChatInvoicer is implemented by providers that deliver the invoice as a
+// message in the user's chat instead of returning a payment URL.
+type ChatInvoicer interface {
+	SendInvoice(chatID int64, amount money.Amount) (*Invoice, error)
+}
+
+// Stars issues invoices in Telegram Stars (XTR). Payments are confirmed by
+// pre_checkout_query and successful_payment updates, not by polling.
+type Stars struct {
+	API Requester
+	// Rate is the balance credited for one star.
+	Rate money.Amount
+	Min  money.Amount
+}
+
+func (s *Stars) Name() string           { return "stars" }
+func (s *Stars) Title() string          { return "Telegram Stars" }
+func (s *Stars) MinTopup() money.Amount { return s.Min }
+
+// StarsFor returns how many stars cover amount, rounding up.
+func (s *Stars) StarsFor(amount money.Amount) int {
+	return int((amount + s.Rate - 1) / s.Rate)
+}
+
+func newPayload() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "stars_" + hex.EncodeToString(buf), nil
+}
+
+func (s *Stars) invoiceParams(amount money.Amount) (tgbotapi.Params, *Invoice, error) {
+	if s.Rate <= 0 {
+		return nil, nil, fmt.Errorf("stars rate is not configured")
+	}
+	stars := s.StarsFor(amount)
+	if stars < 1 {
+		stars = 1
+	}
+	payload, err := newPayload()
+	if err != nil {
+		return nil, nil, err
+	}
+	credit := money.Amount(stars) * s.Rate
+	params := tgbotapi.Params{
+		"title":          "Пополнение баланса",
+		"description":    fmt.Sprintf("Пополнение счёта на %s$", credit),
+		"payload":        payload,
+		"provider_token": "",
+		"currency":       "XTR",
+	}
+	if err := params.AddInterface("prices", []tgbotapi.LabeledPrice{{Label: "XTR", Amount: stars}}); err != nil {
+		return nil, nil, err
+	}
+	return params, &Invoice{ID: payload, Amount: credit}, nil
+}
+
+// CreateInvoice returns an invoice link that can be opened from any chat.
+func (s *Stars) CreateInvoice(amount money.Amount) (*Invoice, error) {
+	params, inv, err := s.invoiceParams(amount)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.API.MakeRequest("createInvoiceLink", params)
+	if err != nil {
+		return nil, fmt.Errorf("Stars createInvoiceLink: %w", err)
+	}
+	if err := json.Unmarshal(resp.Result, &inv.URL); err != nil {
+		return nil, fmt.Errorf("Stars decode: %w", err)
+	}
+	return inv, nil
+}
+
+// SendInvoice posts an XTR invoice with a pay button into the chat.
+func (s *Stars) SendInvoice(chatID int64, amount money.Amount) (*Invoice, error) {
+	params, inv, err := s.invoiceParams(amount)
+	if err != nil {
+		return nil, err
+	}
+	params.AddFirstValid("chat_id", chatID)
+	if _, err := s.API.MakeRequest("sendInvoice", params); err != nil {
+		return nil, fmt.Errorf("Stars sendInvoice: %w", err)
+	}
+	return inv, nil
+}
+
+// CheckInvoice always reports unpaid: Stars payments are credited when the
+// successful_payment update arrives.
+func (s *Stars) CheckInvoice(id string) (bool, error) {
+	return false, nil
+}
+
+func (s *Stars) HealthCheck() error {
+	if s.Rate <= 0 {
+		return fmt.Errorf("stars_rate must be positive")
+	}
+	return nil
+}
+
+// ValidCheckout reports whether a pre-checkout query matches an invoice of
+// amount issued by this provider.
+func (s *Stars) ValidCheckout(amount money.Amount, currency string, total int) bool {
+	return currency == "XTR" && money.Amount(total)*s.Rate == amount
+}
@@ -0,0 +1,77 @@
+package payments
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/example/filestoragebot/money"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fakeBotAPI answers the few Bot API methods used by the Stars provider.
+func fakeBotAPI(t *testing.T, sent *[]map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		params := map[string]string{"method": method}
+		for k := range r.PostForm {
+			params[k] = r.PostForm.Get(k)
+		}
+		*sent = append(*sent, params)
+		switch method {
+		case "getMe":
+			fmt.Fprint(w, `{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"test","username":"test_bot"}}`)
+		case "sendInvoice":
+			fmt.Fprint(w, `{"ok":true,"result":{"message_id":5,"date":0,"chat":{"id":10,"type":"private"}}}`)
+		case "createInvoiceLink":
+			fmt.Fprint(w, `{"ok":true,"result":"https://t.me/$invoice"}`)
+		default:
+			fmt.Fprint(w, `{"ok":false,"error_code":404,"description":"Not Found"}`)
+		}
+	}))
+}
+
+func TestStarsSendInvoice(t *testing.T) {
+	var sent []map[string]string
+	ts := fakeBotAPI(t, &sent)
+	defer ts.Close()
+	api, err := tgbotapi.NewBotAPIWithAPIEndpoint("token", ts.URL+"/bot%s/%s")
+	if err != nil {
+		t.Fatalf("api: %v", err)
+	}
+	s := &Stars{API: api, Rate: 20000}
+
+	inv, err := s.SendInvoice(10, 1010000)
+	if err != nil {
+		t.Fatalf("SendInvoice: %v", err)
+	}
+	req := sent[len(sent)-1]
+	if req["method"] != "sendInvoice" || req["currency"] != "XTR" || req["chat_id"] != "10" {
+		t.Fatalf("unexpected request %v", req)
+	}
+	var prices []tgbotapi.LabeledPrice
+	if err := json.Unmarshal([]byte(req["prices"]), &prices); err != nil || len(prices) != 1 {
+		t.Fatalf("prices %q: %v", req["prices"], err)
+	}
+	if prices[0].Amount != 51 {
+		t.Fatalf("stars %d, want 51", prices[0].Amount)
+	}
+	if inv.ID != req["payload"] || !strings.HasPrefix(inv.ID, "stars_") {
+		t.Fatalf("payload %q, invoice %q", req["payload"], inv.ID)
+	}
+	if !s.ValidCheckout(inv.Amount, "XTR", 51) || s.ValidCheckout(inv.Amount, "XTR", 50) {
+		t.Fatalf("checkout validation mismatch for amount %v", inv.Amount)
+	}
+
+	link, err := s.CreateInvoice(2 * money.USDT)
+	if err != nil {
+		t.Fatalf("CreateInvoice: %v", err)
+	}
+	if link.URL != "https://t.me/$invoice" || link.Amount != 2*money.USDT {
+		t.Fatalf("link %+v", link)
+	}
+}
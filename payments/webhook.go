@@ -0,0 +1,26 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// ErrSignature is returned for webhook updates with a missing or wrong
+// signature.
+var ErrSignature = errors.New("invalid webhook signature")
+
+// validSignature checks a webhook signature computed as the hex encoded
+// HMAC-SHA256 of the body keyed with SHA256 of the API token. Both CryptoBot
+// and xRocket sign their updates this way.
+func validSignature(token string, body []byte, signature string) bool {
+	if token == "" || signature == "" {
+		return false
+	}
+	secret := sha256.Sum256([]byte(token))
+	mac := hmac.New(sha256.New, secret[:])
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
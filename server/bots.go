@@ -0,0 +1,85 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/example/filestoragebot/config"
+	uaParser "github.com/mssola/user_agent"
+)
+
+// defaultBotAgents are link preview fetchers that do not identify as bots in
+// a way user_agent recognises. Only crawler tokens belong here: names of apps
+// and browsers people use, such as Viber's in-app browser or Yandex Browser,
+// must not match.
+var defaultBotAgents = []string{
+	"telegrambot",
+	"whatsapp",
+	"slackbot",
+	"slack-imgproxy",
+	"facebookexternalhit",
+	"facebookcatalog",
+	"twitterbot",
+	"discordbot",
+	"linkedinbot",
+	"skypeuripreview",
+	"vkshare",
+	"redditbot",
+	"iframely",
+	"embedly",
+	"applebot",
+	"yandexbot",
+	"yandeximages",
+	"yandexmobilebot",
+}
+
+// botFilter tells automated clients from people.
+type botFilter struct {
+	agents []string
+	nets   []*net.IPNet
+}
+
+// newBotFilter adds the bot_user_agents substrings and bot_networks CIDR
+// ranges from the configuration to the built-in list.
+func newBotFilter(cfg *config.Config) (*botFilter, error) {
+	f := &botFilter{agents: append([]string(nil), defaultBotAgents...)}
+	for _, a := range cfg.BotUserAgents {
+		if a = strings.ToLower(strings.TrimSpace(a)); a != "" {
+			f.agents = append(f.agents, a)
+		}
+	}
+	for _, c := range cfg.BotNetworks {
+		_, n, err := net.ParseCIDR(strings.TrimSpace(c))
+		if err != nil {
+			return nil, fmt.Errorf("bot_networks: %v", err)
+		}
+		f.nets = append(f.nets, n)
+	}
+	return f, nil
+}
+
+// match reports whether a request with user agent ua from ip is automated.
+// An empty user agent counts as a bot.
+func (f *botFilter) match(ua string, ip string) bool {
+	if strings.TrimSpace(ua) == "" {
+		return true
+	}
+	if uaParser.New(ua).Bot() {
+		return true
+	}
+	lower := strings.ToLower(ua)
+	for _, a := range f.agents {
+		if strings.Contains(lower, a) {
+			return true
+		}
+	}
+	if addr := net.ParseIP(ip); addr != nil {
+		for _, n := range f.nets {
+			if n.Contains(addr) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/example/filestoragebot/config"
+)
+
+func TestBotFilter(t *testing.T) {
+	f, err := newBotFilter(&config.Config{
+		BotUserAgents: []string{"MyMonitor"},
+		BotNetworks:   []string{"203.0.113.0/24"},
+	})
+	if err != nil {
+		t.Fatalf("newBotFilter: %v", err)
+	}
+	cases := []struct {
+		ua, ip string
+		bot    bool
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36", "1.1.1.1", false},
+		{"TelegramBot (like TwitterBot)", "1.1.1.1", true},
+		{"WhatsApp/2.23.20.0", "1.1.1.1", true},
+		{"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", "1.1.1.1", true},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", "1.1.1.1", true},
+		{"mymonitor/1.0", "1.1.1.1", true},
+		{"curl/8.0", "203.0.113.7", true},
+		{"curl/8.0", "1.1.1.1", false},
+		{"Mozilla/5.0 (compatible; YandexBot/3.0; +http://yandex.com/bots)", "1.1.1.1", true},
+		{"Mozilla/5.0 (compatible; YandexImages/3.0; +http://yandex.com/bots)", "1.1.1.1", true},
+		// people in Yandex Browser, the Yandex app and Viber's in-app browser
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 YaBrowser/24.1.0.0 Safari/537.36", "1.1.1.1", false},
+		{"Mozilla/5.0 (Linux; Android 13; SM-A525F) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 YaBrowser/23.11 YaApp_Android/23.116.1 YaSearchBrowser/23.116.1 Mobile Safari/537.36", "1.1.1.1", false},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 Viber/21.5.0", "1.1.1.1", false},
+		{"", "1.1.1.1", true},
+	}
+	for _, c := range cases {
+		if got := f.match(c.ua, c.ip); got != c.bot {
+			t.Errorf("%q from %s: bot=%v, want %v", c.ua, c.ip, got, c.bot)
+		}
+	}
+	if _, err := newBotFilter(&config.Config{BotNetworks: []string{"nonsense"}}); err == nil {
+		t.Fatalf("invalid CIDR accepted")
+	}
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/example/filestoragebot/geoip"
+	"github.com/example/filestoragebot/logdb"
+	"github.com/example/filestoragebot/models"
+	uaParser "github.com/mssola/user_agent"
+)
+
+// downloadEvent is a finished download waiting to be logged.
+type downloadEvent struct {
+	file      models.File
+	slug      string
+	ip        string
+	userAgent string
+	// event is the logdb event kind, a download when empty.
+	event string
+	// bot requests are logged but not notified.
+	bot bool
+}
+
+// events logs downloads in the background so that serving a file never
+// waits for geolocation, the log database or Telegram.
+type events struct {
+	ch     chan downloadEvent
+	logs   *logdb.DB
+	geo    geoip.Resolver
+	notify func(int64, string)
+}
+
+func newEvents(size int, logs *logdb.DB, geo geoip.Resolver, notify func(int64, string)) *events {
+	if size <= 0 {
+		size = 1024
+	}
+	return &events{ch: make(chan downloadEvent, size), logs: logs, geo: geo, notify: notify}
+}
+
+// push queues ev without blocking; the event is dropped when the queue is
+// full.
+func (e *events) push(ev downloadEvent) {
+	select {
+	case e.ch <- ev:
+	default:
+		log.Println("downloads: queue full, event dropped for file", ev.file.ID)
+	}
+}
+
+func (e *events) run() {
+	for ev := range e.ch {
+		e.handle(ev)
+	}
+}
+
+func (e *events) handle(ev downloadEvent) {
+	ua := uaParser.New(ev.userAgent)
+	osInfo := ua.OSInfo()
+	platform := ua.Platform()
+	model := ua.Model()
+	browserName, browserVer := ua.Browser()
+
+	var loc geoip.Location
+	if ip := net.ParseIP(ev.ip); ip != nil && e.geo != nil {
+		l, err := e.geo.Lookup(ip)
+		if err != nil {
+			log.Println("geoip:", err)
+		}
+		loc = l
+	}
+
+	err := e.logs.Add(ev.file.ID, &logdb.Entry{
+		Event:       ev.event,
+		Slug:        ev.slug,
+		Bot:         ev.bot,
+		IP:          ev.ip,
+		City:        loc.City,
+		Country:     loc.Country,
+		Platform:    platform,
+		Model:       model,
+		OSName:      osInfo.Name,
+		OSVersion:   osInfo.Version,
+		BrowserName: browserName,
+		BrowserVer:  browserVer,
+	})
+	if err != nil {
+		log.Println("logdb:", err)
+	}
+
+	if ev.file.Notify && e.notify != nil && !ev.bot && (ev.event == "" || ev.event == logdb.EventDownload) {
+		info := fmt.Sprintf("\xF0\x9F\x95\x8B Файл: %s\n\xF0\x9F\x93\x9A Тег: %s\n\xF0\x9F\x8C\x8D IP: %s\n\xF0\x9F\x97\xBD Локация: %s, %s\n\xF0\x9F\x93\xB1 Устройство: %s %s\n\xF0\x9F\x92\xBB ОС: %s %s\n\xF0\x9F\x8C\x90 Браузер: %s %s",
+			ev.file.LocalName, ev.slug, ev.ip, loc.City, loc.Country, platform, model, osInfo.Name, osInfo.Version, browserName, browserVer)
+		e.notify(ev.file.UserID, info)
+	}
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// defaultInlineTypes may be shown in the browser when inline_mime_types is
+// not set. Nothing here can run script.
+var defaultInlineTypes = []string{
+	"image/png", "image/jpeg", "image/gif", "image/webp",
+	"video/mp4", "video/webm", "audio/mpeg", "audio/ogg",
+	"text/plain",
+}
+
+// blobCSP keeps anything the browser does render from running script or
+// loading other resources.
+const blobCSP = "default-src 'none'; img-src 'self'; media-src 'self'; style-src 'unsafe-inline'; sandbox"
+
+// contentPolicy decides how uploaded files are presented to browsers.
+type contentPolicy struct {
+	inline map[string]bool
+}
+
+// newContentPolicy builds the policy from the allowlist; nil means the
+// defaults and an empty list forces every file to download.
+func newContentPolicy(types []string) *contentPolicy {
+	if types == nil {
+		types = defaultInlineTypes
+	}
+	p := &contentPolicy{inline: make(map[string]bool)}
+	for _, t := range types {
+		p.inline[strings.ToLower(strings.TrimSpace(t))] = true
+	}
+	return p
+}
+
+// apply sets the type, disposition and protection headers of a download
+// named name.
+func (p *contentPolicy) apply(w http.ResponseWriter, name string) {
+	ctype := mime.TypeByExtension(strings.ToLower(filepath.Ext(name)))
+	base, _, err := mime.ParseMediaType(ctype)
+	if ctype == "" || err != nil {
+		ctype, base = "application/octet-stream", "application/octet-stream"
+	}
+	disposition := "attachment"
+	if p.inline[base] {
+		disposition = "inline"
+	} else {
+		// never let the browser render a type it was not allowed to
+		ctype = "application/octet-stream"
+	}
+	h := w.Header()
+	h.Set("Content-Type", ctype)
+	h.Set("Content-Disposition", contentDisposition(disposition, name))
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Security-Policy", blobCSP)
+}
+
+// contentDisposition encodes name as an RFC 6266 parameter with an ASCII
+// fallback for old clients.
+func contentDisposition(disposition, name string) string {
+	var fallback strings.Builder
+	for _, r := range name {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			fallback.WriteByte('_')
+		} else {
+			fallback.WriteRune(r)
+		}
+	}
+	return disposition + `; filename="` + fallback.String() + `"; filename*=UTF-8''` + encodeRFC5987(name)
+}
+
+func encodeRFC5987(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContentPolicy(t *testing.T) {
+	p := newContentPolicy(nil)
+	cases := []struct {
+		name        string
+		ctype       string
+		disposition string
+	}{
+		{"photo.png", "image/png", `inline; filename="photo.png"; filename*=UTF-8''photo.png`},
+		{"page.html", "application/octet-stream", `attachment; filename="page.html"; filename*=UTF-8''page.html`},
+		{"logo.SVG", "application/octet-stream", `attachment; filename="logo.SVG"; filename*=UTF-8''logo.SVG`},
+		{"отчёт 1.pdf", "application/octet-stream", `attachment; filename="_____ 1.pdf"; filename*=UTF-8''%D0%BE%D1%82%D1%87%D1%91%D1%82%201.pdf`},
+		{`a"b`, "application/octet-stream", `attachment; filename="a_b"; filename*=UTF-8''a%22b`},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		p.apply(w, c.name)
+		h := w.Header()
+		if h.Get("Content-Type") != c.ctype || h.Get("Content-Disposition") != c.disposition {
+			t.Errorf("%s: got %q %q", c.name, h.Get("Content-Type"), h.Get("Content-Disposition"))
+		}
+		if h.Get("X-Content-Type-Options") != "nosniff" || h.Get("Content-Security-Policy") == "" {
+			t.Errorf("%s: protection headers missing", c.name)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	newContentPolicy([]string{}).apply(w, "photo.png")
+	if got := w.Header().Get("Content-Disposition"); got[:10] != "attachment" {
+		t.Errorf("empty allowlist: got %q", got)
+	}
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/example/filestoragebot/config"
+)
+
+// hosts lists the hostnames files are served on; empty serves any host.
+type hosts map[string]bool
+
+// newHosts allows the served_hosts entries and the host of domain, or any
+// host when served_hosts is empty.
+func newHosts(cfg *config.Config) hosts {
+	if len(cfg.ServedHosts) == 0 {
+		return nil
+	}
+	h := make(hosts)
+	if u, err := url.Parse(cfg.Domain); err == nil && u.Hostname() != "" {
+		h[strings.ToLower(u.Hostname())] = true
+	}
+	for _, name := range cfg.ServedHosts {
+		h[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	return h
+}
+
+// serves reports whether a request for host may get files.
+func (h hosts) serves(host string) bool {
+	if h == nil {
+		return true
+	}
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	return h[strings.ToLower(strings.TrimSuffix(host, "."))]
+}
@@ -0,0 +1,26 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/example/filestoragebot/config"
+)
+
+func TestHosts(t *testing.T) {
+	if !newHosts(&config.Config{Domain: "https://files.example.com"}).serves("other.example.org") {
+		t.Error("without served_hosts every host is served")
+	}
+	h := newHosts(&config.Config{Domain: "https://files.example.com/f", ServedHosts: []string{"Old.Example.com"}})
+	for host, want := range map[string]bool{
+		"files.example.com":      true,
+		"FILES.example.com:8443": true,
+		"old.example.com":        true,
+		"old.example.com.":       true,
+		"evil.example.com":       false,
+		"":                       false,
+	} {
+		if got := h.serves(host); got != want {
+			t.Errorf("%q: got %v", host, got)
+		}
+	}
+}
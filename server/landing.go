@@ -0,0 +1,124 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/example/filestoragebot/models"
+)
+
+// downloadPath is the sub-path that serves the blob of a file with a landing
+// page.
+const downloadPath = "download"
+
+// splitPath returns the slug of a request path and whether the blob
+// sub-path was requested.
+func splitPath(p string) (slug string, blob bool) {
+	p = strings.Trim(p, "/")
+	if i := strings.LastIndex(p, "/"); i >= 0 {
+		if p[i+1:] == downloadPath {
+			p = p[:i]
+			blob = true
+		}
+	}
+	if i := strings.LastIndex(p, "/"); i >= 0 {
+		p = p[i+1:]
+	}
+	return p, blob
+}
+
+var landingTemplate = template.Must(template.New("landing").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width,initial-scale=1">
+<title>{{.Name}}</title>
+<meta property="og:title" content="{{.Name}}">
+<meta property="og:description" content="{{if .Description}}{{.Description}}{{else}}{{.Size}}{{end}}">
+<style>
+body{background:#111;color:#eee;font-family:sans-serif;display:flex;justify-content:center;padding:40px 16px}
+main{max-width:480px;width:100%;background:#1c1c1c;border-radius:12px;padding:24px}
+h1{font-size:1.4em;word-break:break-all}
+p.desc{white-space:pre-wrap}
+dl{display:grid;grid-template-columns:auto 1fr;gap:6px 16px;color:#aaa}
+a.button{display:block;margin-top:24px;padding:14px;text-align:center;background:#2a7ae2;color:#fff;border-radius:8px;text-decoration:none}
+</style>
+</head>
+<body>
+<main>
+<h1>{{.Name}}</h1>
+{{if .Description}}<p class="desc">{{.Description}}</p>{{end}}
+<dl>
+<dt>Размер</dt><dd>{{.Size}}</dd>
+{{if .Uploaded}}<dt>Загружен</dt><dd>{{.Uploaded}}</dd>{{end}}
+</dl>
+<a class="button" href="{{.DownloadURL}}" rel="nofollow">Скачать</a>
+</main>
+</body>
+</html>
+`))
+
+type landingData struct {
+	Name        string
+	Description string
+	Size        string
+	Uploaded    string
+	DownloadURL string
+}
+
+// humanSize formats a byte count for people.
+func humanSize(n int64) string {
+	units := []string{"Б", "КБ", "МБ", "ГБ"}
+	v := float64(n)
+	i := 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d %s", n, units[0])
+	}
+	return fmt.Sprintf("%.1f %s", v, units[i])
+}
+
+// formatDate renders a created_at value, which SQLite returns either as
+// RFC 3339 or in its own layout.
+func formatDate(s string) string {
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC().Format("02.01.2006")
+		}
+	}
+	return ""
+}
+
+// landing renders the page of f. The download button keeps the query so
+// that signed URLs stay valid on the blob sub-path.
+func landing(w http.ResponseWriter, r *http.Request, slug string, f *models.File, size int64) {
+	// relative, so the page works behind a proxy that adds a path prefix
+	rel := slug + "/" + downloadPath
+	if strings.HasSuffix(r.URL.Path, "/") {
+		rel = downloadPath
+	}
+	u := url.URL{Path: rel, RawQuery: r.URL.RawQuery}
+	data := landingData{
+		Name:        f.LocalName,
+		Description: f.Description,
+		Size:        humanSize(size),
+		Uploaded:    formatDate(f.CreatedAt),
+		DownloadURL: u.String(),
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := landingTemplate.Execute(w, data); err != nil {
+		log.Println("landing:", err)
+	}
+}
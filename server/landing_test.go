@@ -0,0 +1,42 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/example/filestoragebot/models"
+)
+
+func TestSplitPath(t *testing.T) {
+	cases := []struct {
+		path string
+		slug string
+		blob bool
+	}{
+		{"/report", "report", false},
+		{"/report/", "report", false},
+		{"/report/download", "report", true},
+		{"/files/report/download", "report", true},
+		{"/download", "download", false},
+		{"/", "", false},
+	}
+	for _, c := range cases {
+		slug, blob := splitPath(c.path)
+		if slug != c.slug || blob != c.blob {
+			t.Errorf("%s: got %q %v", c.path, slug, blob)
+		}
+	}
+}
+
+func TestLandingPage(t *testing.T) {
+	f := &models.File{LocalName: "<b>report</b>.pdf", Description: "Q3", CreatedAt: "2024-05-06T07:08:09Z"}
+	w := httptest.NewRecorder()
+	landing(w, httptest.NewRequest("GET", "/report?exp=1&sig=abc", nil), "report", f, 1536)
+	body := w.Body.String()
+	for _, want := range []string{"&lt;b&gt;report&lt;/b&gt;.pdf", "1.5 КБ", "06.05.2024", "Q3", `href="report/download?exp=1&amp;sig=abc"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page lacks %q", want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/example/filestoragebot/config"
+	"github.com/example/filestoragebot/models"
+	"github.com/example/filestoragebot/storage"
+)
+
+const gonePage = `<!DOCTYPE html>
+<html lang="ru">
+<head><meta charset="utf-8"><title>Ссылка недоступна</title></head>
+<body style="font-family:sans-serif;text-align:center;margin-top:15%">
+<h1>410</h1>
+<p>Срок действия ссылки истёк или лимит скачиваний исчерпан.</p>
+</body>
+</html>
+`
+
+const forbiddenPage = `<!DOCTYPE html>
+<html lang="ru">
+<head><meta charset="utf-8"><title>Доступ запрещён</title></head>
+<body style="font-family:sans-serif;text-align:center;margin-top:15%">
+<h1>403</h1>
+<p>Файл доступен только по действующей подписанной ссылке.</p>
+</body>
+</html>
+`
+
+// gone answers with the 410 page shown for expired links.
+func gone(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusGone)
+	w.Write([]byte(gonePage))
+}
+
+// forbidden answers with the page shown for missing or forged signatures.
+func forbidden(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+	w.Write([]byte(forbiddenPage))
+}
+
+// expired reports whether the link lifetime of f has passed.
+func expired(f *models.File, now time.Time) bool {
+	return f.ExpiresAt > 0 && now.Unix() >= f.ExpiresAt
+}
+
+// exhausted reports whether f has used up its downloads.
+func exhausted(f *models.File) bool {
+	return f.MaxDownloads > 0 && f.Downloads >= f.MaxDownloads
+}
+
+// startsDownload reports whether r begins a new download rather than
+// resuming one, so that range requests of a download manager count once.
+func startsDownload(r *http.Request) bool {
+	if r.Method == http.MethodHead {
+		return false
+	}
+	rng := r.Header.Get("Range")
+	return rng == "" || strings.HasPrefix(rng, "bytes=0-")
+}
+
+// countingWriter records the status and body size of a response.
+type countingWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (c *countingWriter) WriteHeader(status int) {
+	c.status = status
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	n, err := c.ResponseWriter.Write(p)
+	c.written += int64(n)
+	return n, err
+}
+
+// consumeOneTime finishes a one-time download: the owner is told and, when
+// one_time_delete is set, the blob is removed. The record stays so the link
+// keeps answering 410.
+func consumeOneTime(cfg *config.Config, store storage.Backend, f *models.File, notify func(int64, string)) {
+	text := fmt.Sprintf("\xF0\x9F\x94\xA5 Файл %s скачан по одноразовой ссылке, ссылка больше не действует", f.LocalName)
+	if cfg.DeleteOneTime() {
+		if err := store.Delete(f.Blob); err != nil {
+			log.Println("storage:", err)
+		} else {
+			text += ", файл удалён"
+		}
+	}
+	if notify != nil {
+		notify(f.UserID, text)
+	}
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/example/filestoragebot/config"
+	"github.com/example/filestoragebot/models"
+	"github.com/example/filestoragebot/storage"
+)
+
+func TestConsumeOneTime(t *testing.T) {
+	off := false
+	for _, c := range []struct {
+		name string
+		cfg  *config.Config
+		keep bool
+	}{
+		// configs written before one_time_delete existed delete the blob
+		{"missing", &config.Config{}, false},
+		{"off", &config.Config{OneTimeDelete: &off}, true},
+	} {
+		store := storage.NewLocal(t.TempDir())
+		if err := store.Put("blob", strings.NewReader("data"), 4); err != nil {
+			t.Fatal(err)
+		}
+		consumeOneTime(c.cfg, store, &models.File{Blob: "blob"}, nil)
+		if _, err := store.Stat("blob"); (err == nil) != c.keep {
+			t.Errorf("%s: blob kept=%v, want %v", c.name, err == nil, c.keep)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/example/filestoragebot/config"
+	"github.com/example/filestoragebot/db"
+	"github.com/example/filestoragebot/linksign"
+	"github.com/example/filestoragebot/models"
+	"github.com/example/filestoragebot/slug"
+)
+
+const movedPage = `<!DOCTYPE html>
+<html lang="ru">
+<head><meta charset="utf-8"><title>Ссылка изменена</title></head>
+<body style="font-family:sans-serif;text-align:center;margin-top:15%%">
+<p>Владелец изменил ссылку на файл. Новый адрес:</p>
+<p><a href="%[1]s">%[1]s</a></p>
+</body>
+</html>
+`
+
+// findFile looks a requested slug up among current links, aliases and then
+// old links. name is the link or alias that matched; moved reports a match on
+// an old link.
+func findFile(database *db.DB, requested string) (f *models.File, name string, moved bool, err error) {
+	// links created before slugs were folded keep their case, so the exact
+	// key wins over the folded one
+	keys := []string{requested}
+	if k := slug.Fold(requested); k != requested {
+		keys = append(keys, k)
+	}
+	for _, k := range keys {
+		if f, err = database.GetFileBySlug(k); err == nil {
+			return f, k, false, nil
+		}
+	}
+	for _, k := range keys {
+		if f, err = database.GetFileByAlias(k); err == nil {
+			return f, k, false, nil
+		}
+	}
+	for _, k := range keys {
+		if f, err = database.GetFileByOldSlug(k); err == nil {
+			return f, k, true, nil
+		}
+	}
+	return nil, "", false, err
+}
+
+// moved sends a request for old, an old link of f, to its current link,
+// either with a permanent redirect or, with moved_links: page, a page naming
+// it. A signed request is checked against the old link and re-signed for the
+// new one with the same expiry.
+func moved(w http.ResponseWriter, r *http.Request, cfg *config.Config, secret []byte, f *models.File, old string, blob bool) {
+	target := strings.TrimRight(cfg.Domain, "/") + "/" + f.Slug
+	if blob {
+		target += "/" + downloadPath
+	}
+	q := r.URL.Query()
+	if linksign.Signed(q) {
+		ok, stale := linksign.Check(secret, old, q, time.Now())
+		if stale {
+			gone(w)
+			return
+		}
+		if !ok {
+			forbidden(w)
+			return
+		}
+		exp, _ := strconv.ParseInt(q.Get("exp"), 10, 64)
+		linksign.SignQuery(secret, f.Slug, q, time.Unix(exp, 0))
+	}
+	if len(q) > 0 {
+		target += "?" + q.Encode()
+	}
+	if cfg.MovedLinks == "page" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, movedPage, template.HTMLEscapeString(target))
+		return
+	}
+	http.Redirect(w, r, target, http.StatusMovedPermanently)
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/example/filestoragebot/config"
+	"github.com/example/filestoragebot/linksign"
+	"github.com/example/filestoragebot/models"
+)
+
+func TestMoved(t *testing.T) {
+	f := &models.File{Slug: "new"}
+	cfg := &config.Config{Domain: "https://files.example.com/"}
+	secret := []byte("secret")
+
+	w := httptest.NewRecorder()
+	moved(w, httptest.NewRequest("GET", "/old/download", nil), cfg, secret, f, "old", true)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "https://files.example.com/new/download" {
+		t.Fatalf("redirect: %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	cfg.MovedLinks = "page"
+	w = httptest.NewRecorder()
+	moved(w, httptest.NewRequest("GET", "/old", nil), cfg, secret, f, "old", false)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `href="https://files.example.com/new"`) {
+		t.Fatalf("page: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestMovedSigned(t *testing.T) {
+	f := &models.File{Slug: "new"}
+	cfg := &config.Config{Domain: "https://files.example.com"}
+	secret := []byte("secret")
+	now := time.Now()
+
+	signed, _ := linksign.Sign(secret, "https://files.example.com/old", now.Add(time.Hour))
+	u, _ := url.Parse(signed)
+	w := httptest.NewRecorder()
+	moved(w, httptest.NewRequest("GET", u.RequestURI(), nil), cfg, secret, f, "old", false)
+	loc, err := url.Parse(w.Header().Get("Location"))
+	if w.Code != http.StatusMovedPermanently || err != nil || loc.Path != "/new" {
+		t.Fatalf("redirect: %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if ok, _ := linksign.Check(secret, "new", loc.Query(), now); !ok {
+		t.Fatalf("redirect target is not signed for the new link: %s", loc)
+	}
+	if loc.Query().Get("exp") != u.Query().Get("exp") {
+		t.Fatalf("expiry changed: %s", loc)
+	}
+
+	forged := u.Query()
+	forged.Set("sig", "x")
+	w = httptest.NewRecorder()
+	moved(w, httptest.NewRequest("GET", "/old?"+forged.Encode(), nil), cfg, secret, f, "old", false)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("forged signature: %d", w.Code)
+	}
+
+	stale, _ := linksign.Sign(secret, "https://files.example.com/old", now.Add(-time.Minute))
+	u, _ = url.Parse(stale)
+	w = httptest.NewRecorder()
+	moved(w, httptest.NewRequest("GET", u.RequestURI(), nil), cfg, secret, f, "old", false)
+	if w.Code != http.StatusGone {
+		t.Fatalf("expired signature: %d", w.Code)
+	}
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/example/filestoragebot/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// passwordCookieTTL is how long a correct password unlocks a file.
+	passwordCookieTTL = 15 * time.Minute
+	// maxPasswordFailures failed attempts per address and file are allowed
+	// within passwordWindow.
+	maxPasswordFailures = 5
+	passwordWindow      = 15 * time.Minute
+)
+
+// failures counts wrong passwords per client and file.
+type failures struct {
+	mu sync.Mutex
+	m  map[string]*failure
+}
+
+type failure struct {
+	count int
+	reset time.Time
+}
+
+func newFailures() *failures {
+	return &failures{m: make(map[string]*failure)}
+}
+
+// blocked reports whether key has used up its attempts.
+func (l *failures) blocked(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, ok := l.m[key]
+	if !ok {
+		return false
+	}
+	if now.After(f.reset) {
+		delete(l.m, key)
+		return false
+	}
+	return f.count >= maxPasswordFailures
+}
+
+func (l *failures) add(key string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// drop stale entries so the map does not grow without bound
+	for k, f := range l.m {
+		if now.After(f.reset) {
+			delete(l.m, k)
+		}
+	}
+	f, ok := l.m[key]
+	if !ok {
+		f = &failure{reset: now.Add(passwordWindow)}
+		l.m[key] = f
+	}
+	f.count++
+}
+
+func (l *failures) clear(key string) {
+	l.mu.Lock()
+	delete(l.m, key)
+	l.mu.Unlock()
+}
+
+func passwordCookieName(f *models.File) string {
+	return fmt.Sprintf("dl_%d", f.ID)
+}
+
+// passwordMAC binds the cookie to the file and to its current password hash,
+// so changing the password invalidates issued cookies.
+func passwordMAC(secret []byte, f *models.File, exp int64) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%d|%d|%s", f.ID, exp, f.PasswordHash)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func unlocked(secret []byte, f *models.File, r *http.Request, now time.Time) bool {
+	c, err := r.Cookie(passwordCookieName(f))
+	if err != nil {
+		return false
+	}
+	expStr, sig, ok := strings.Cut(c.Value, ".")
+	if !ok {
+		return false
+	}
+	exp, err := strconv.ParseInt(expStr, 10, 64)
+	if err != nil || now.Unix() > exp {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(passwordMAC(secret, f, exp)))
+}
+
+func setUnlockCookie(w http.ResponseWriter, r *http.Request, secret []byte, f *models.File, cookiePath string, now time.Time) {
+	exp := now.Add(passwordCookieTTL).Unix()
+	http.SetCookie(w, &http.Cookie{
+		Name:     passwordCookieName(f),
+		Value:    fmt.Sprintf("%d.%s", exp, passwordMAC(secret, f, exp)),
+		Path:     cookiePath,
+		MaxAge:   int(passwordCookieTTL / time.Second),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+const passwordForm = `<!DOCTYPE html>
+<html lang="ru">
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width,initial-scale=1"><title>%s</title></head>
+<body style="font-family:sans-serif;text-align:center;margin-top:15%%">
+<h2>%s</h2>
+<p>%s</p>
+<form method="post">
+<input type="password" name="password" autofocus required>
+<button type="submit">Скачать</button>
+</form>
+</body>
+</html>
+`
+
+func passwordPage(w http.ResponseWriter, status int, f *models.File, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	name := html.EscapeString(f.LocalName)
+	fmt.Fprintf(w, passwordForm, name, name, html.EscapeString(message))
+}
+
+// passwordGate handles the password form of a protected file. It returns
+// true when the request may go on to download the file and reports wrong
+// passwords through failed. The unlock cookie is scoped to cookiePath.
+func passwordGate(w http.ResponseWriter, r *http.Request, secret []byte, limiter *failures, f *models.File, ip string,
+	cookiePath string, failed func()) bool {
+	now := time.Now()
+	if unlocked(secret, f, r, now) {
+		return true
+	}
+	if r.Method != http.MethodPost {
+		passwordPage(w, http.StatusUnauthorized, f, "Файл защищён паролем")
+		return false
+	}
+	key := fmt.Sprintf("%s|%d", ip, f.ID)
+	if limiter.blocked(key, now) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(passwordWindow/time.Second)))
+		passwordPage(w, http.StatusTooManyRequests, f, "Слишком много попыток, попробуйте позже")
+		return false
+	}
+	if bcrypt.CompareHashAndPassword([]byte(f.PasswordHash), []byte(r.PostFormValue("password"))) != nil {
+		limiter.add(key, now)
+		failed()
+		passwordPage(w, http.StatusUnauthorized, f, "Неверный пароль")
+		return false
+	}
+	limiter.clear(key)
+	setUnlockCookie(w, r, secret, f, cookiePath, now)
+	// the download itself happens on a plain GET so that it can be resumed
+	http.Redirect(w, r, r.URL.RequestURI(), http.StatusSeeOther)
+	return false
+}
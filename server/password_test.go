@@ -0,0 +1,69 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/example/filestoragebot/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordGate(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	f := &models.File{ID: 3, LocalName: "doc", PasswordHash: string(hash)}
+	key := []byte("key")
+	limiter := newFailures()
+	failed := 0
+	try := func(ip, password string) *httptest.ResponseRecorder {
+		form := url.Values{"password": {password}}
+		r := httptest.NewRequest(http.MethodPost, "/doc", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		if passwordGate(w, r, key, limiter, f, ip, "/doc", func() { failed++ }) {
+			t.Fatalf("POST passed the gate")
+		}
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	if passwordGate(w, httptest.NewRequest(http.MethodGet, "/doc", nil), key, limiter, f, "1.1.1.1", "/doc", nil) ||
+		w.Code != http.StatusUnauthorized {
+		t.Fatalf("GET without cookie: %d", w.Code)
+	}
+	for i := 0; i < maxPasswordFailures; i++ {
+		if w := try("1.1.1.1", "wrong"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: %d", i, w.Code)
+		}
+	}
+	if w := try("1.1.1.1", "secret"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("rate limit not applied: %d", w.Code)
+	}
+	if failed != maxPasswordFailures {
+		t.Fatalf("%d failures reported", failed)
+	}
+
+	w = try("2.2.2.2", "secret")
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("correct password: %d", w.Code)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("cookies %v", cookies)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/doc", nil)
+	r.AddCookie(cookies[0])
+	if !passwordGate(httptest.NewRecorder(), r, key, limiter, f, "2.2.2.2", "/doc", nil) {
+		t.Fatalf("cookie not accepted")
+	}
+	if unlocked(key, f, r, time.Now().Add(passwordCookieTTL+time.Minute)) {
+		t.Fatalf("expired cookie accepted")
+	}
+	f.PasswordHash = "changed"
+	if unlocked(key, f, r, time.Now()) {
+		t.Fatalf("cookie survived a password change")
+	}
+}
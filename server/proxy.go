@@ -0,0 +1,122 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// defaultTrustedProxies apply when trusted_proxies is not set: a reverse
+// proxy on the same host.
+var defaultTrustedProxies = []string{"127.0.0.0/8", "::1/128"}
+
+// proxies resolves the client address of requests that passed through
+// trusted reverse proxies.
+type proxies struct {
+	trusted []*net.IPNet
+}
+
+// newProxies parses CIDR ranges or single addresses. A nil list means the
+// defaults; an empty list trusts nobody.
+func newProxies(list []string) (*proxies, error) {
+	if list == nil {
+		list = defaultTrustedProxies
+	}
+	p := &proxies{}
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil {
+				bits := 8 * len(ip.To16())
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 32
+				}
+				p.trusted = append(p.trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("trusted_proxies: %v", err)
+		}
+		p.trusted = append(p.trusted, n)
+	}
+	return p, nil
+}
+
+func (p *proxies) isTrusted(ip net.IP) bool {
+	for _, n := range p.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client. Forwarding headers are only
+// believed when the connection comes from a trusted proxy, and the chain is
+// walked from the nearest hop back until the first untrusted address, which
+// is the client as far as trusted proxies can vouch for.
+func (p *proxies) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote := net.ParseIP(host)
+	if remote == nil || !p.isTrusted(remote) {
+		return host
+	}
+
+	var chain []string
+	if v := r.Header.Values("Forwarded"); len(v) > 0 {
+		chain = forwardedFor(v)
+	} else if v := r.Header.Values("X-Forwarded-For"); len(v) > 0 {
+		for _, h := range v {
+			chain = append(chain, strings.Split(h, ",")...)
+		}
+	} else if v := r.Header.Get("X-Real-IP"); v != "" {
+		chain = []string{v}
+	}
+
+	client := remote
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := parseHop(chain[i])
+		if ip == nil {
+			// unknown or obfuscated hop: nothing beyond it can be trusted
+			break
+		}
+		client = ip
+		if !p.isTrusted(ip) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// forwardedFor extracts the for= parameters of RFC 7239 Forwarded headers.
+func forwardedFor(headers []string) []string {
+	var res []string
+	for _, h := range headers {
+		for _, elem := range strings.Split(h, ",") {
+			for _, pair := range strings.Split(elem, ";") {
+				k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(k, "for") {
+					res = append(res, v)
+				}
+			}
+		}
+	}
+	return res
+}
+
+// parseHop reads one address from a forwarding header, which may be quoted
+// and carry a port, e.g. "[2001:db8::1]:4711" or 192.0.2.1:80.
+func parseHop(s string) net.IP {
+	s = strings.Trim(strings.TrimSpace(s), `"`)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	return net.ParseIP(s)
+}
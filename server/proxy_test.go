@@ -0,0 +1,79 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	p, err := newProxies([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32"})
+	if err != nil {
+		t.Fatalf("newProxies: %v", err)
+	}
+	cases := []struct {
+		name   string
+		remote string
+		header map[string]string
+		want   string
+	}{
+		{"direct", "203.0.113.5:1234", nil, "203.0.113.5"},
+		{"spoofed from untrusted peer", "203.0.113.5:1234", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "203.0.113.5"},
+		{"one trusted hop", "10.0.0.1:80", map[string]string{"X-Forwarded-For": "198.51.100.7"}, "198.51.100.7"},
+		{"client prepends a fake hop", "10.0.0.1:80", map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.7"}, "198.51.100.7"},
+		{"two trusted hops", "10.0.0.1:80", map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.7, 192.0.2.1"}, "198.51.100.7"},
+		{"all hops trusted", "10.0.0.1:80", map[string]string{"X-Forwarded-For": "10.1.1.1, 10.2.2.2"}, "10.1.1.1"},
+		{"garbage hop", "10.0.0.1:80", map[string]string{"X-Forwarded-For": "nonsense"}, "10.0.0.1"},
+		{"real ip", "10.0.0.1:80", map[string]string{"X-Real-IP": "198.51.100.7"}, "198.51.100.7"},
+		{"forwarded", "10.0.0.1:80", map[string]string{"Forwarded": `for=1.2.3.4, for="[2001:db8:cafe::17]:4711";proto=https, for=198.51.100.7:80`}, "198.51.100.7"},
+		{"forwarded through trusted v6", "10.0.0.1:80", map[string]string{"Forwarded": `for=198.51.100.9, for="[2001:db8:cafe::17]:4711"`}, "198.51.100.9"},
+		{"forwarded wins over x-forwarded-for", "10.0.0.1:80", map[string]string{"Forwarded": "for=198.51.100.7", "X-Forwarded-For": "1.2.3.4"}, "198.51.100.7"},
+		{"obfuscated hop", "10.0.0.1:80", map[string]string{"Forwarded": "for=198.51.100.7, for=_hidden"}, "10.0.0.1"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/file", nil)
+		r.RemoteAddr = c.remote
+		for k, v := range c.header {
+			r.Header.Set(k, v)
+		}
+		if got := p.clientIP(r); got != c.want {
+			t.Errorf("%s: got %s, want %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestClientIPDefaults(t *testing.T) {
+	p, err := newProxies(nil)
+	if err != nil {
+		t.Fatalf("newProxies: %v", err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, p.clientIP(r))
+	}))
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	// the test server is reached over loopback, which is trusted by default
+	if string(body) != "198.51.100.7" {
+		t.Fatalf("got %s", body)
+	}
+
+	none, _ := newProxies([]string{})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "127.0.0.1:5000"
+	r.Header.Set("X-Forwarded-For", "198.51.100.7")
+	if got := none.clientIP(r); got != "127.0.0.1" {
+		t.Fatalf("empty list trusted the header: %s", got)
+	}
+	if _, err := newProxies([]string{"bad/cidr"}); err == nil {
+		t.Fatalf("invalid entry accepted")
+	}
+}
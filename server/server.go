@@ -1,87 +1,190 @@
 package server
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
+	"crypto/rand"
 	"log"
-	"net"
 	"net/http"
-	"os"
-	"path"
-	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/example/filestoragebot/config"
 	"github.com/example/filestoragebot/db"
+	"github.com/example/filestoragebot/geoip"
+	"github.com/example/filestoragebot/linksign"
 	"github.com/example/filestoragebot/logdb"
-	uaParser "github.com/mssola/user_agent"
+	"github.com/example/filestoragebot/models"
+	"github.com/example/filestoragebot/payments"
+	"github.com/example/filestoragebot/storage"
 )
 
-func Start(cfg *config.Config, database *db.DB, logs *logdb.DB, notify func(int64, string)) error {
+// Start serves uploaded files and payment webhooks. Downloads are logged in
+// the background with locations from geo; notify delivers download
+// notifications to file owners and credited is called once for every invoice
+// credited through a webhook.
+func Start(cfg *config.Config, database *db.DB, logs *logdb.DB, store storage.Backend, providers *payments.Registry,
+	geo geoip.Resolver, notify func(int64, string), credited func(*models.Payment)) error {
+	downloads := newEvents(cfg.DownloadQueue, logs, geo, notify)
+	go downloads.run()
+	secret := []byte(cfg.ServerSecret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		rand.Read(secret)
+		log.Println("server_secret is empty, using a random key until restart")
+	}
+	limiter := newFailures()
+	bots, err := newBotFilter(cfg)
+	if err != nil {
+		return err
+	}
+	proxies, err := newProxies(cfg.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	content := newContentPolicy(cfg.InlineMIMETypes)
+	hosts := newHosts(cfg)
+
 	handler := func(w http.ResponseWriter, r *http.Request) {
-		slug := path.Base(r.URL.Path)
-		if slug == "" || slug == "." || slug == "/" {
+		requested, blob := splitPath(r.URL.Path)
+		if requested == "" || !hosts.serves(r.Host) {
 			http.NotFound(w, r)
 			return
 		}
 
-		link := strings.TrimRight(cfg.Domain, "/") + "/" + slug
-		f, err := database.GetFileByLink(link)
+		// name is the link or alias used, which signatures, the landing
+		// page and the log refer to
+		f, name, old, err := findFile(database, requested)
 		if err != nil {
 			http.NotFound(w, r)
 			return
 		}
+		if old {
+			moved(w, r, cfg, secret, f, name, blob)
+			return
+		}
 
-		fp := filepath.Join(cfg.FileStoragePath, f.StorageName)
-		if _, err := os.Stat(fp); os.IsNotExist(err) {
-			http.NotFound(w, r)
+		if expired(f, time.Now()) {
+			gone(w)
+			return
+		}
+		if q := r.URL.Query(); linksign.Signed(q) {
+			ok, stale := linksign.Check(secret, name, q, time.Now())
+			if stale {
+				gone(w)
+				return
+			}
+			if !ok {
+				forbidden(w)
+				return
+			}
+		} else if f.SignedOnly {
+			forbidden(w)
+			return
+		}
+		ip := proxies.clientIP(r)
+		if f.PasswordHash != "" {
+			failed := func() {
+				downloads.push(downloadEvent{file: *f, slug: name, ip: ip, userAgent: r.UserAgent(), event: logdb.EventBadPassword})
+			}
+			// one cookie unlocks both the landing page and the blob
+			cookiePath := r.URL.Path
+			if blob {
+				cookiePath = strings.TrimSuffix(strings.TrimRight(cookiePath, "/"), "/"+downloadPath)
+			}
+			if !passwordGate(w, r, secret, limiter, f, ip, cookiePath, failed) {
+				return
+			}
+		}
+		if f.Consumed {
+			gone(w)
 			return
 		}
-		http.ServeFile(w, r, fp)
 
-		ua := uaParser.New(r.UserAgent())
-		osInfo := ua.OSInfo()
-		platform := ua.Platform()
-		model := ua.Model()
-		browserName, browserVer := ua.Browser()
+		info, err := store.Stat(f.Blob)
+		if err != nil {
+			if err != storage.ErrNotExist {
+				log.Println("storage:", err)
+			}
+			http.NotFound(w, r)
+			return
+		}
 
-		ip := r.Header.Get("X-Forwarded-For")
-		if ip == "" {
-			ip, _, _ = net.SplitHostPort(r.RemoteAddr)
-		} else {
-			ip = strings.TrimSpace(strings.Split(ip, ",")[0])
+		bot := r.Method == http.MethodHead || bots.match(r.UserAgent(), ip)
+		// page views, including link preview crawlers, are not downloads;
+		// bots never get the blob of a limited file, so a spoofed user
+		// agent cannot get around the limits
+		if (f.Landing && !blob) || (bot && (f.OneTime || f.MaxDownloads > 0)) {
+			landing(w, r, name, f, info.Size)
+			return
 		}
 
-		var loc struct {
-			City    string `json:"city"`
-			Country string `json:"country"`
+		oneTime := f.OneTime && r.Method != http.MethodHead
+		if oneTime {
+			// a one-time link is only spent by a complete download, so
+			// partial requests are answered with the whole file
+			r.Header.Del("Range")
+			ok, err := database.ClaimOneTime(f.ID)
+			if err != nil {
+				log.Println("db:", err)
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			if !ok {
+				gone(w)
+				return
+			}
 		}
-		if resp, err := http.Get("https://ipinfo.io/" + ip + "/json"); err == nil {
-			data, _ := io.ReadAll(resp.Body)
-			resp.Body.Close()
-			json.Unmarshal(data, &loc)
+		release := func() {
+			if oneTime {
+				if err := database.ReleaseOneTime(f.ID); err != nil {
+					log.Println("db:", err)
+				}
+			}
+		}
+		if !bot && startsDownload(r) {
+			ok, err := database.CountDownload(f.ID)
+			if err != nil {
+				release()
+				log.Println("db:", err)
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			if !ok {
+				release()
+				gone(w)
+				return
+			}
+		} else if r.Method == http.MethodHead && exhausted(f) {
+			// resumed downloads are let through until the janitor
+			// removes the file
+			gone(w)
+			return
 		}
 
-		_ = logs.Add(f.ID, &logdb.Entry{
-			IP:          ip,
-			City:        loc.City,
-			Country:     loc.Country,
-			Platform:    platform,
-			Model:       model,
-			OSName:      osInfo.Name,
-			OSVersion:   osInfo.Version,
-			BrowserName: browserName,
-			BrowserVer:  browserVer,
-		})
-
-		if f.Notify && notify != nil {
-			info := fmt.Sprintf("\xF0\x9F\x95\x8B Файл: %s\n\xF0\x9F\x93\x9A \u0422\u0435\u0433: %s\n\xF0\x9F\x8C\x8D IP: %s\n\xF0\x9F\x97\xBD \u041B\u043E\u043A\u0430\u0446\u0438\u044F: %s, %s\n\xF0\x9F\x93\xB1 \u0423\u0441\u0442\u0440\u043E\u0439\u0441\u0442\u0432\u043E: %s %s\n\xF0\x9F\x92\xBB \u041E\u0421: %s %s\n\xF0\x9F\x8C\x90 \u0411\u0440\u0430\u0443\u0437\u0435\u0440: %s %s",
-				f.LocalName, slug, ip, loc.City, loc.Country, platform, model, osInfo.Name, osInfo.Version, browserName, browserVer)
-			notify(f.UserID, info)
+		fileName := f.FileName
+		if fileName == "" {
+			fileName = f.LocalName
+		}
+		content.apply(w, fileName)
+		cw := &countingWriter{ResponseWriter: w}
+		blobReader := storage.NewReader(store, f.Blob, info.Size)
+		http.ServeContent(cw, r, fileName, info.ModTime, blobReader)
+		blobReader.Close()
+		if oneTime {
+			if cw.status == http.StatusOK && cw.written == info.Size {
+				consumeOneTime(cfg, store, f, notify)
+			} else {
+				release()
+			}
 		}
+
+		downloads.push(downloadEvent{file: *f, slug: name, ip: ip, userAgent: r.UserAgent(), bot: bot})
 	}
 	http.HandleFunc("/", handler)
+	for _, p := range providers.Providers() {
+		if hook, ok := p.(payments.Webhook); ok {
+			http.HandleFunc(hook.WebhookPath(), webhookHandler(p, hook, database, credited))
+		}
+	}
 
 	addr := cfg.HTTPAddress
 	if cfg.TLSCert != "" && cfg.TLSKey != "" {
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"database/sql"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/example/filestoragebot/db"
+	"github.com/example/filestoragebot/models"
+	"github.com/example/filestoragebot/payments"
+)
+
+// webhookHandler verifies updates pushed by a payment provider and credits
+// the invoice they report as paid.
+func webhookHandler(p payments.Provider, hook payments.Webhook, database *db.DB, credited func(*models.Payment)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		invoiceID, paid, err := hook.ParseWebhook(r.Header, body)
+		if err == payments.ErrSignature {
+			log.Printf("[%s] webhook with invalid signature from %s", p.Title(), r.RemoteAddr)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			log.Printf("[%s] webhook decode: %v", p.Title(), err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if paid && invoiceID != "" {
+			payment, ok, err := database.CreditInvoice(p.Name(), invoiceID)
+			switch {
+			case err == sql.ErrNoRows:
+				log.Printf("[%s] webhook for unknown invoice %s", p.Title(), invoiceID)
+			case err != nil:
+				log.Printf("[%s] credit invoice: %v", p.Title(), err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			case ok && credited != nil:
+				credited(payment)
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
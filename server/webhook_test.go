@@ -0,0 +1,63 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/example/filestoragebot/db"
+	"github.com/example/filestoragebot/models"
+	"github.com/example/filestoragebot/money"
+	"github.com/example/filestoragebot/payments"
+)
+
+func sign(token, body string) string {
+	secret := sha256.Sum256([]byte(token))
+	mac := hmac.New(sha256.New, secret[:])
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestCryptoBotWebhook(t *testing.T) {
+	database, err := db.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("db: %v", err)
+	}
+	userID, _ := database.GetOrCreateUser(7)
+	if _, err := database.AddInvoice(userID, 3*money.USDT, "crypto", "99"); err != nil {
+		t.Fatalf("AddInvoice: %v", err)
+	}
+	var got []*models.Payment
+	provider := &payments.CryptoBot{Token: "token"}
+	h := webhookHandler(provider, provider, database, func(p *models.Payment) { got = append(got, p) })
+
+	body := `{"update_id":1,"update_type":"invoice_paid","payload":{"invoice_id":99,"status":"paid"}}`
+	send := func(sig string) int {
+		req := httptest.NewRequest(http.MethodPost, "/webhook/cryptobot", strings.NewReader(body))
+		req.Header.Set("crypto-pay-api-signature", sig)
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec.Code
+	}
+
+	if code := send(sign("wrong", body)); code != http.StatusUnauthorized {
+		t.Fatalf("bad signature: status %d", code)
+	}
+	if code := send(sign("token", body)); code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	if code := send(sign("token", body)); code != http.StatusOK {
+		t.Fatalf("repeat status %d", code)
+	}
+	if len(got) != 1 || got[0].Amount != 3*money.USDT {
+		t.Fatalf("credited %v", got)
+	}
+	if bal, _ := database.GetBalance(userID); bal != 3*money.USDT {
+		t.Fatalf("balance %v", bal)
+	}
+}
@@ -0,0 +1,92 @@
+// Package slug defines which link parts files may be published under.
+package slug
+
+import (
+	"crypto/rand"
+	"errors"
+	"strings"
+)
+
+const (
+	MinLength = 3
+	MaxLength = 64
+	// RandomLength is the length of generated slugs.
+	RandomLength = 8
+)
+
+var (
+	ErrLength    = errors.New("slug length out of range")
+	ErrCharset   = errors.New("slug contains forbidden characters")
+	ErrReserved  = errors.New("slug is reserved")
+	ErrExhausted = errors.New("no free random slug found")
+)
+
+// reserved holds names the server uses or may use for its own routes.
+var reserved = map[string]bool{
+	"download": true,
+	"webhook":  true,
+	"api":      true,
+	"admin":    true,
+	"static":   true,
+	"assets":   true,
+	"health":   true,
+	"metrics":  true,
+	"login":    true,
+	"logout":   true,
+}
+
+// Fold returns the canonical form of s used for storage and lookups.
+func Fold(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// Normalize folds s and checks it against the policy: latin letters, digits,
+// '-' and '_', starting and ending with a letter or digit.
+func Normalize(s string) (string, error) {
+	s = Fold(s)
+	if len(s) < MinLength || len(s) > MaxLength {
+		return "", ErrLength
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', '0' <= c && c <= '9':
+		case (c == '-' || c == '_') && i > 0 && i < len(s)-1:
+		default:
+			return "", ErrCharset
+		}
+	}
+	if reserved[s] {
+		return "", ErrReserved
+	}
+	return s, nil
+}
+
+// alphabet leaves out characters that are easy to confuse when a link is
+// read aloud or retyped.
+const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// Random returns a fresh slug for which taken reports false.
+func Random(taken func(string) (bool, error)) (string, error) {
+	buf := make([]byte, RandomLength)
+	for try := 0; try < 10; try++ {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for i, b := range buf {
+			buf[i] = alphabet[int(b)%len(alphabet)]
+		}
+		s := string(buf)
+		if reserved[s] {
+			continue
+		}
+		busy, err := taken(s)
+		if err != nil {
+			return "", err
+		}
+		if !busy {
+			return s, nil
+		}
+	}
+	return "", ErrExhausted
+}
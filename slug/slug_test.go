@@ -0,0 +1,46 @@
+package slug
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+		err  error
+	}{
+		{" Report-2024 ", "report-2024", nil},
+		{"my_file", "my_file", nil},
+		{"ab", "", ErrLength},
+		{"", "", ErrLength},
+		{"a/b/c", "", ErrCharset},
+		{"two words", "", ErrCharset},
+		{"отчёт", "", ErrCharset},
+		{"-lead", "", ErrCharset},
+		{"trail_", "", ErrCharset},
+		{"Download", "", ErrReserved},
+		{"webhook", "", ErrReserved},
+	}
+	for _, c := range cases {
+		got, err := Normalize(c.in)
+		if got != c.want || err != c.err {
+			t.Errorf("%q: got %q %v", c.in, got, err)
+		}
+	}
+}
+
+func TestRandom(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 50; i++ {
+		s, err := Random(func(s string) (bool, error) { return seen[s], nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, err := Normalize(s); err != nil || n != s {
+			t.Fatalf("%q does not pass the policy: %v", s, err)
+		}
+		seen[s] = true
+	}
+	if _, err := Random(func(string) (bool, error) { return true, nil }); err != ErrExhausted {
+		t.Errorf("got %v, want ErrExhausted", err)
+	}
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Local keeps objects as plain files inside a directory.
+type Local struct {
+	Dir string
+}
+
+// NewLocal returns a backend rooted at dir.
+func NewLocal(dir string) *Local {
+	return &Local{Dir: dir}
+}
+
+func (l *Local) path(name string) string {
+	return filepath.Join(l.Dir, filepath.Base(name))
+}
+
+func (l *Local) Put(name string, r io.Reader, size int64) error {
+	if err := os.MkdirAll(l.Dir, 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(l.path(name))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return err
+	}
+	return out.Close()
+}
+
+// Move takes ownership of the file at src, renaming it into the storage
+// directory. When a rename is impossible (different filesystems) the file is
+// copied and the source removed.
+func (l *Local) Move(name, src string) error {
+	if err := os.MkdirAll(l.Dir, 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, l.path(name)); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := l.Put(name, in, -1); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+func (l *Local) Get(name string) (io.ReadCloser, error) {
+	f, err := os.Open(l.path(name))
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	}
+	return f, err
+}
+
+type limitedFile struct {
+	io.Reader
+	f *os.File
+}
+
+func (l *limitedFile) Close() error {
+	return l.f.Close()
+}
+
+func (l *Local) GetRange(name string, offset, length int64) (io.ReadCloser, error) {
+	f, err := os.Open(l.path(name))
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &limitedFile{Reader: io.LimitReader(f, length), f: f}, nil
+}
+
+func (l *Local) Stat(name string) (Info, error) {
+	st, err := os.Stat(l.path(name))
+	if os.IsNotExist(err) {
+		return Info{}, ErrNotExist
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{Size: st.Size(), ModTime: st.ModTime()}, nil
+}
+
+func (l *Local) Delete(name string) error {
+	err := os.Remove(l.path(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3 stores objects in a bucket of an S3-compatible service (AWS, MinIO,
+// Ceph and so on). Requests use path-style addressing and AWS Signature V4.
+type S3 struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Client    *http.Client
+}
+
+func (s *S3) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+	return http.DefaultClient
+}
+
+func (s *S3) region() string {
+	if s.Region == "" {
+		return "us-east-1"
+	}
+	return s.Region
+}
+
+func (s *S3) objectURL(name string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimRight(s.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	u.Path = u.Path + "/" + s.Bucket + "/" + name
+	u.RawPath = ""
+	return u, nil
+}
+
+func (s *S3) do(method, name string, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	u, err := s.objectURL(name)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	s.sign(req, time.Now())
+	return s.client().Do(req)
+}
+
+// sign adds AWS Signature V4 headers. The payload is left unsigned so large
+// uploads can be streamed without hashing them first.
+func (s *S3) sign(req *http.Request, now time.Time) {
+	const payload = "UNSIGNED-PAYLOAD"
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payload + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payload,
+	}, "\n")
+
+	scope := day + "/" + s.region() + "/s3/aws4_request"
+	sum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), day)
+	key = hmacSHA256(key, s.region())
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func s3Error(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("S3 HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+}
+
+func (s *S3) Put(name string, r io.Reader, size int64) error {
+	if size < 0 {
+		// S3 needs a Content-Length, so spool streams of unknown size first.
+		tmp, err := os.CreateTemp("", "s3put-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		if size, err = io.Copy(tmp, r); err != nil {
+			return err
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		r = tmp
+	}
+	var body io.Reader
+	if size > 0 {
+		body = io.NopCloser(r)
+	}
+	resp, err := s.do(http.MethodPut, name, body, size, nil)
+	if err != nil {
+		return fmt.Errorf("S3 request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+func (s *S3) get(name string, header http.Header) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, name, nil, 0, header)
+	if err != nil {
+		return nil, fmt.Errorf("S3 request: %w", err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotExist
+	default:
+		defer resp.Body.Close()
+		return nil, s3Error(resp)
+	}
+}
+
+func (s *S3) Get(name string) (io.ReadCloser, error) {
+	return s.get(name, nil)
+}
+
+func (s *S3) GetRange(name string, offset, length int64) (io.ReadCloser, error) {
+	if length <= 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	h := http.Header{}
+	h.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	return s.get(name, h)
+}
+
+func (s *S3) Stat(name string) (Info, error) {
+	resp, err := s.do(http.MethodHead, name, nil, 0, nil)
+	if err != nil {
+		return Info{}, fmt.Errorf("S3 request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return Info{}, ErrNotExist
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Info{}, fmt.Errorf("S3 HTTP %d", resp.StatusCode)
+	}
+	size := resp.ContentLength
+	if size < 0 {
+		var err error
+		if size, err = strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64); err != nil {
+			return Info{}, fmt.Errorf("S3 content length: %w", err)
+		}
+	}
+	mod, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return Info{Size: size, ModTime: mod}, nil
+}
+
+func (s *S3) Delete(name string) error {
+	resp, err := s.do(http.MethodDelete, name, nil, 0, nil)
+	if err != nil {
+		return fmt.Errorf("S3 request: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	default:
+		return s3Error(resp)
+	}
+}
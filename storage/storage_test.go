@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is a tiny in-memory stand-in for an S3-compatible server.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		http.Error(w, "unsigned", http.StatusForbidden)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := r.URL.Path
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		f.objects[key] = data
+	case http.MethodGet, http.MethodHead:
+		data, ok := f.objects[key]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, key, time.Unix(0, 0), bytes.NewReader(data))
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func testBackend(t *testing.T, b Backend) {
+	data := []byte("0123456789abcdef")
+	if err := b.Put("obj", bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	info, err := b.Stat("obj")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Size != int64(len(data)) {
+		t.Fatalf("size %d, want %d", info.Size, len(data))
+	}
+	rc, err := b.GetRange("obj", 4, 6)
+	if err != nil {
+		t.Fatalf("GetRange: %v", err)
+	}
+	part, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(part) != "456789" {
+		t.Fatalf("range got %q", part)
+	}
+	r := NewReader(b, "obj", info.Size)
+	if _, err := r.Seek(10, io.SeekStart); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	tail, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(tail) != "abcdef" {
+		t.Fatalf("reader got %q, %v", tail, err)
+	}
+	if err := b.Delete("obj"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := b.Stat("obj"); err != ErrNotExist {
+		t.Fatalf("expected ErrNotExist, got %v", err)
+	}
+	if _, err := b.Get("obj"); err != ErrNotExist {
+		t.Fatalf("expected ErrNotExist, got %v", err)
+	}
+}
+
+func TestLocalBackend(t *testing.T) {
+	testBackend(t, NewLocal(t.TempDir()))
+}
+
+func TestS3Backend(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+	s := &S3{Endpoint: ts.URL, Bucket: "files", AccessKey: "key", SecretKey: "secret"}
+	testBackend(t, s)
+	if err := s.Put("unknown", strings.NewReader("stream"), -1); err != nil {
+		t.Fatalf("Put unknown size: %v", err)
+	}
+	if got := string(fake.objects["/files/unknown"]); got != "stream" {
+		t.Fatalf("stored %q", got)
+	}
+}
+
+func TestS3SignatureStable(t *testing.T) {
+	s := &S3{Endpoint: "http://minio:9000", Bucket: "b", AccessKey: "AK", SecretKey: "SK", Region: "eu"}
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	sign := func() string {
+		req, _ := http.NewRequest(http.MethodGet, "http://minio:9000/b/x", nil)
+		s.sign(req, now)
+		return req.Header.Get("Authorization")
+	}
+	a, b := sign(), sign()
+	if a != b {
+		t.Fatalf("signature not deterministic")
+	}
+	want := "AWS4-HMAC-SHA256 Credential=AK/20240102/eu/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature="
+	if !strings.HasPrefix(a, want) {
+		t.Fatalf("unexpected header %q", a)
+	}
+}